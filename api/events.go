@@ -0,0 +1,96 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/scanner"
+)
+
+const eventBuffer = 256
+
+type eventJSON struct {
+	Type   string        `json:"type"`
+	Phase  scanner.Phase `json:"phase,omitempty"`
+	Total  int           `json:"total,omitempty"`
+	IP     string        `json:"ip,omitempty"`
+	Result *ipJSON       `json:"result,omitempty"`
+	Status *status       `json:"status,omitempty"`
+}
+
+var eventNames = map[scanner.EventType]string{
+	scanner.EventPhaseStart: "phase_start",
+	scanner.EventPhaseEnd:   "phase_end",
+	scanner.EventIPDone:     "ip_done",
+}
+
+// handleEvents streams scan progress as server-sent events. Per-probe and
+// byte counter events are left out; a status snapshot is sent every second
+// instead. Slow clients miss events rather than stalling the scan.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	events := make(chan eventJSON, eventBuffer)
+	unsubscribe := scanner.Subscribe(func(e scanner.Event) {
+		name, ok := eventNames[e.Type]
+		if !ok {
+			return
+		}
+		ev := eventJSON{Type: name, Phase: e.Phase, Total: e.Total}
+		if e.IP != nil {
+			ev.IP = e.IP.String()
+		}
+		if e.Result != nil {
+			res := toJSON(*e.Result)
+			ev.Result = &res
+		}
+		select {
+		case events <- ev:
+		default:
+		}
+	})
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	send := func(ev eventJSON) bool {
+		data, err := json.Marshal(ev)
+		if err != nil {
+			return true
+		}
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data); err != nil {
+			return false
+		}
+		flusher.Flush()
+		return true
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev := <-events:
+			if !send(ev) {
+				return
+			}
+		case <-ticker.C:
+			s.mu.Lock()
+			st := s.status
+			s.mu.Unlock()
+			if !send(eventJSON{Type: "status", Status: &st}) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,385 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/scanner"
+)
+
+type Options struct {
+	Enabled bool   `json:"enabled"`
+	Listen  string `json:"listen"`
+	Token   string `json:"token"`
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Listen: "127.0.0.1:8086",
+	}
+}
+
+// PoolSource supplies the current best IPs when the server runs next to a
+// daemon. Results of on-demand scans are only used while the pool is empty.
+type PoolSource interface {
+	Pool() []scanner.IPResult
+}
+
+type ipJSON struct {
+	IP            string                `json:"ip"`
+	Sent          int                   `json:"sent"`
+	Received      int                   `json:"received"`
+	LossRate      float32               `json:"loss_rate"`
+	DelayMs       int                   `json:"delay_ms"`
+	JitterMs      int                   `json:"jitter_ms"`
+	MinDelayMs    int                   `json:"min_delay_ms"`
+	MedianDelayMs int                   `json:"median_delay_ms"`
+	P95DelayMs    int                   `json:"p95_delay_ms"`
+	MaxDelayMs    int                   `json:"max_delay_ms"`
+	DownloadMBps  float64               `json:"download_mbps"`
+	PeakMBps      float64               `json:"peak_mbps"`
+	TTFBMs        int                   `json:"ttfb_ms"`
+	UploadMBps    float64               `json:"upload_mbps"`
+	Stability     float64               `json:"stability"`
+	Score         float64               `json:"score"`
+	Failures      scanner.FailureCounts `json:"failures,omitempty"`
+	Xray          *tunnelJSON           `json:"xray,omitempty"`
+}
+
+// tunnelJSON holds the results through Xray of a combined scan. IPs the
+// scan did not get to check through Xray have none, and download_mbps is
+// left out for IPs that were not speed tested.
+type tunnelJSON struct {
+	OK           bool                  `json:"ok"`
+	Sent         int                   `json:"sent"`
+	Received     int                   `json:"received"`
+	LossRate     float32               `json:"loss_rate"`
+	DelayMs      int                   `json:"delay_ms"`
+	DownloadMBps *float64              `json:"download_mbps,omitempty"`
+	Failures     scanner.FailureCounts `json:"failures,omitempty"`
+}
+
+func toJSON(r scanner.IPResult) ipJSON {
+	j := ipJSON{
+		IP:            r.IP.String(),
+		Sent:          r.Sended,
+		Received:      r.Received,
+		LossRate:      r.LossRate,
+		DelayMs:       r.Delay,
+		JitterMs:      r.Jitter,
+		MinDelayMs:    r.MinDelay,
+		MedianDelayMs: r.MedianDelay,
+		P95DelayMs:    r.P95Delay,
+		MaxDelayMs:    r.MaxDelay,
+		DownloadMBps:  r.DownloadSpeed / 1024 / 1024,
+		PeakMBps:      r.PeakSpeed / 1024 / 1024,
+		TTFBMs:        r.TTFB,
+		UploadMBps:    r.UploadSpeed / 1024 / 1024,
+		Stability:     r.Stability,
+		Score:         r.Score,
+		Failures:      r.Failures,
+	}
+	if t := r.Tunnel; t != nil {
+		j.Xray = &tunnelJSON{
+			OK:       t.OK(),
+			Sent:     t.Sended,
+			Received: t.Received,
+			LossRate: t.LossRate,
+			DelayMs:  t.Delay,
+			Failures: t.Failures,
+		}
+		if t.SpeedTested {
+			mbps := t.DownloadSpeed / 1024 / 1024
+			j.Xray.DownloadMBps = &mbps
+		}
+	}
+	return j
+}
+
+type status struct {
+	Running   bool          `json:"running"`
+	Mode      scanner.Mode  `json:"mode,omitempty"`
+	Phase     scanner.Phase `json:"phase,omitempty"`
+	Done      int           `json:"done"`
+	Total     int           `json:"total"`
+	Found     int           `json:"found"`
+	StartedAt *time.Time    `json:"started_at,omitempty"`
+	LastScan  *time.Time    `json:"last_scan,omitempty"`
+}
+
+// Server exposes scan control and results over HTTP so other programs can
+// fetch fresh IPs without parsing the result files.
+type Server struct {
+	opts   Options
+	ranges []string
+	pool   PoolSource
+
+	mu      sync.Mutex
+	scan    *scanner.Scan
+	status  status
+	results []scanner.IPResult
+	history *scanner.History
+
+	mux *http.ServeMux
+}
+
+func New(opts Options, ranges []string, history *scanner.History, pool PoolSource) *Server {
+	s := &Server{
+		opts:    opts,
+		ranges:  ranges,
+		pool:    pool,
+		history: history,
+		mux:     http.NewServeMux(),
+	}
+	s.mux.HandleFunc("/api/scan/start", s.handleStart)
+	s.mux.HandleFunc("/api/scan/stop", s.handleStop)
+	s.mux.HandleFunc("/api/status", s.handleStatus)
+	s.mux.HandleFunc("/api/events", s.handleEvents)
+	s.mux.HandleFunc("/api/ips", s.handleIPs)
+	s.mux.HandleFunc("/api/links", s.handleLinks)
+	s.mux.HandleFunc("/api/config", s.handleConfig)
+
+	scanner.Subscribe(s.trackProgress)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// authorized reports whether r carries the token, as a bearer token or in
+// the token query parameter.
+func (s *Server) authorized(r *http.Request) bool {
+	if s.opts.Token == "" {
+		return true
+	}
+	token := []byte(s.opts.Token)
+	auth := []byte(r.Header.Get("Authorization"))
+	query := []byte(r.URL.Query().Get("token"))
+	return subtle.ConstantTimeCompare(auth, append([]byte("Bearer "), token...)) == 1 ||
+		subtle.ConstantTimeCompare(query, token) == 1
+}
+
+func (s *Server) ListenAndServe() error {
+	return http.ListenAndServe(s.opts.Listen, s)
+}
+
+// trackProgress counts the events of the server's own scan. Scans and
+// daemon cycles never overlap, so events that arrive while no scan of the
+// server runs belong to the daemon and are ignored.
+func (s *Server) trackProgress(e scanner.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.scan == nil {
+		return
+	}
+	switch e.Type {
+	case scanner.EventPhaseStart:
+		s.status.Phase = e.Phase
+		s.status.Total = e.Total
+		s.status.Done = 0
+		s.status.Found = 0
+	case scanner.EventIPDone:
+		s.status.Done++
+		if e.Result != nil {
+			s.status.Found++
+		}
+	}
+}
+
+// StartScan begins a background scan. It fails if one is already running
+// or the daemon is checking its pool.
+func (s *Server) StartScan(mode scanner.Mode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.scan != nil {
+		return fmt.Errorf("a scan is already running")
+	}
+	release, ok := scanner.TryExclusive()
+	if !ok {
+		return fmt.Errorf("the daemon is checking its pool, try again when the cycle is over")
+	}
+
+	scan := scanner.NewScan(mode)
+	now := time.Now()
+	s.scan = scan
+	s.status = status{Running: true, Mode: mode, StartedAt: &now, LastScan: s.status.LastScan}
+
+	go func() {
+		defer release()
+		report := scan.Run(scanner.GenerateIPs(s.ranges), s.history)
+		if s.history != nil {
+			s.history.Save()
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if len(report.Results) > 0 {
+			s.results = report.Results
+		}
+		finished := time.Now()
+		s.scan = nil
+		s.status.Running = false
+		s.status.LastScan = &finished
+	}()
+	return nil
+}
+
+func (s *Server) StopScan() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.scan == nil {
+		return false
+	}
+	s.scan.Stop()
+	return true
+}
+
+// Best returns up to limit of the current best IPs. A limit of zero returns
+// all of them.
+func (s *Server) Best(limit int) []scanner.IPResult {
+	var results []scanner.IPResult
+	if s.pool != nil {
+		results = s.pool.Pool()
+	}
+	if len(results) == 0 {
+		s.mu.Lock()
+		results = append(results, s.results...)
+		s.mu.Unlock()
+	}
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func requirePost(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	return true
+}
+
+func queryLimit(r *http.Request, def int) int {
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v >= 0 {
+		return v
+	}
+	return def
+}
+
+func (s *Server) handleStart(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+	mode := scanner.Mode(r.URL.Query().Get("mode"))
+	if mode == "" {
+		mode = scanner.ModeNormal
+	}
+	if !mode.Valid() {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "mode must be normal, xray or combined"})
+		return
+	}
+	if err := s.StartScan(mode); err != nil {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "started"})
+}
+
+func (s *Server) handleStop(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+	if !s.StopScan() {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "no scan is running"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "stopping"})
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	st := s.status
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, st)
+}
+
+func (s *Server) handleIPs(w http.ResponseWriter, r *http.Request) {
+	results := s.Best(queryLimit(r, 0))
+
+	if r.URL.Query().Get("format") == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, res := range results {
+			fmt.Fprintln(w, res.IP.String())
+		}
+		return
+	}
+
+	list := make([]ipJSON, 0, len(results))
+	for _, res := range results {
+		list = append(list, toJSON(res))
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) handleLinks(w http.ResponseWriter, r *http.Request) {
+	results := s.Best(queryLimit(r, 10))
+
+	var links []string
+	for i, res := range results {
+		link, err := scanner.ShareLink(res.IP.String(), fmt.Sprintf("CF-%d-%s", i+1, res.IP.String()))
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		links = append(links, link)
+	}
+
+	if r.URL.Query().Get("format") == "json" {
+		if links == nil {
+			links = []string{}
+		}
+		writeJSON(w, http.StatusOK, links)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprint(w, strings.Join(links, "\n"))
+}
+
+func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
+	ip := r.URL.Query().Get("ip")
+	if ip == "" {
+		best := s.Best(1)
+		if len(best) == 0 {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "no clean IPs available yet"})
+			return
+		}
+		ip = best[0].IP.String()
+	}
+
+	data, err := scanner.ClientConfig(ip)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
\ No newline at end of file
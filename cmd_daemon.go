@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/fatih/color"
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/config"
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/daemon"
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/notify"
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/scanner"
+)
+
+func runDaemon(settings *config.Settings) {
+	// A combined pool would have to be rechecked through Xray as well,
+	// which the daemon does not do.
+	switch scanner.Mode(settings.Daemon.Mode) {
+	case scanner.ModeNormal:
+	case scanner.ModeXray:
+		checkXrayFiles()
+	default:
+		color.New(color.FgRed).Printf("Unknown daemon mode: %s (use normal or xray)\n", settings.Daemon.Mode)
+		os.Exit(1)
+	}
+	scanner.SetProgressBars(false)
+
+	stopCh := make(chan struct{})
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigChan
+		color.New(color.FgYellow, color.Bold).Println("Interrupt received. Stopping daemon...")
+		close(stopCh)
+	}()
+
+	d := daemon.New(settings.Daemon, config.GetCloudflareRanges())
+	if settings.API.Enabled {
+		startAPI(settings, d)
+	}
+	if settings.Metrics.Enabled {
+		startMetrics(settings).SetPoolSize(d.Size)
+	}
+	if settings.Resolver.DNSEnabled {
+		startResolver(settings, d.Pool)
+	}
+	d.OnCycle(func(pool []scanner.IPResult) {
+		writeHostsFile(settings, pool)
+	})
+	if notifier := notify.New(settings.Notify); notifier.Enabled() {
+		d.OnCycle(func(pool []scanner.IPResult) {
+			if err := notifier.PoolUpdated(pool); err != nil {
+				color.New(color.FgRed).Printf("Error sending notification: %v\n", err)
+			}
+		})
+	}
+	if settings.Publish.Enabled {
+		if p := newPublisher(settings); p != nil {
+			d.OnCycle(func(pool []scanner.IPResult) {
+				publishResults(p, settings, pool)
+			})
+		}
+	}
+	color.New(color.FgCyan).Printf("Daemon mode (%s): keeping %d healthy IPs, checking every %ds. Press Ctrl+C to stop.\n",
+		settings.Daemon.Mode, settings.Daemon.PoolSize, settings.Daemon.CheckIntervalSec)
+	d.Run(stopCh)
+}
\ No newline at end of file
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"github.com/fatih/color"
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/config"
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/scanner"
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/utils"
+)
+
+const fragmentResultsFile = "fragment_results.txt"
+
+// runFragmentSweep looks for the fragment settings that work best through
+// Xray on the IPs given as arguments, or on the best responsive IPs of a
+// fresh latency scan when none are given.
+func runFragmentSweep(settings *config.Settings, args []string) {
+	checkXrayFiles()
+	c := settings.Scanner.Fragment
+
+	grid := scanner.FragmentGrid(c)
+	if len(grid) == 0 {
+		color.New(color.FgRed).Println("The fragment grid is empty. Check packets, lengths and intervals in settings.json.")
+		return
+	}
+
+	sw := newSweep("fragment sweep")
+	ips := sw.ips(args, c.TopIPs)
+	if len(ips) == 0 {
+		return
+	}
+
+	sweepStop := sw.start()
+	color.New(color.FgCyan).Printf("\nTrying %d fragment setting(s) on %d IP(s) through Xray\n", len(grid), len(ips))
+	results := scanner.SweepFragments(sweepStop, ips, c)
+
+	utils.PrintFragmentResults(results)
+	var block []byte
+	if len(results) > 0 && results[0].Succeeded > 0 {
+		var tag, dialer string
+		block, tag, dialer = scanner.FragmentOutbound(results[0].Fragment)
+		utils.PrintFragmentOutbound(block, tag, dialer)
+	} else {
+		color.New(color.FgRed).Println("No fragment setting got through.")
+	}
+	if err := utils.SaveFragmentResults(results, block, fragmentResultsFile); err != nil {
+		color.New(color.FgRed).Printf("Error saving file: %v\n", err)
+	} else {
+		color.New(color.FgGreen).Printf("Fragment results saved to %s\n", fragmentResultsFile)
+	}
+}
\ No newline at end of file
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/config"
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/schedule"
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/scanner"
+)
+
+func runSchedule(settings *config.Settings) {
+	opts := settings.Schedule
+	mode := scanner.Mode(opts.Mode)
+	switch mode {
+	case scanner.ModeNormal:
+	case scanner.ModeXray, scanner.ModeCombined:
+		checkXrayFiles()
+	default:
+		color.New(color.FgRed).Printf("Unknown schedule mode: %s\n", opts.Mode)
+		os.Exit(1)
+	}
+
+	sched, err := schedule.New(opts)
+	if err != nil {
+		color.New(color.FgRed).Printf("Invalid schedule: %v\n", err)
+		os.Exit(1)
+	}
+	if opts.ResultDir != "" {
+		if err := os.MkdirAll(opts.ResultDir, 0755); err != nil {
+			color.New(color.FgRed).Printf("Cannot create result directory: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var mu sync.Mutex
+	var current *scanner.Scan
+
+	stopCh := make(chan struct{})
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigChan
+		color.New(color.FgYellow, color.Bold).Println("\nInterrupt received. Stopping scheduler...")
+		close(stopCh)
+		mu.Lock()
+		if current != nil {
+			current.Stop()
+		}
+		mu.Unlock()
+	}()
+
+	color.New(color.FgCyan).Printf("Schedule mode (%s): %v. Press Ctrl+C to stop.\n", mode, opts.Cron)
+	if opts.QuietHours != "" {
+		color.New(color.FgCyan).Printf("Quiet hours: %s\n", opts.QuietHours)
+	}
+	if opts.DailyDataCapMB > 0 {
+		color.New(color.FgCyan).Printf("Daily data cap: %d MB (%.1f MB used today)\n",
+			opts.DailyDataCapMB, float64(sched.UsedToday())/1024/1024)
+	}
+
+	sched.Run(stopCh, func(capCh <-chan struct{}) {
+		scan := scanner.NewScan(mode)
+		mu.Lock()
+		current = scan
+		mu.Unlock()
+
+		done := make(chan struct{})
+		go func() {
+			select {
+			case <-capCh:
+				color.New(color.FgYellow, color.Bold).Println("\nDaily data cap reached. Stopping this scan...")
+				scan.Stop()
+			case <-done:
+			}
+		}()
+
+		started := time.Now()
+		color.New(color.FgCyan, color.Bold).Printf("\n[%s] Starting scheduled scan\n", started.Format("2006-01-02 15:04:05"))
+		out := outputFiles{
+			results: schedule.ResultPath(opts.ResultDir, defaultOutput.results, started),
+			list:    schedule.ResultPath(opts.ResultDir, defaultOutput.list, started),
+		}
+		runScan(settings, scan, nil, out, false)
+		close(done)
+
+		for _, name := range []string{defaultOutput.results, defaultOutput.list} {
+			if err := schedule.Rotate(opts.ResultDir, name, opts.KeepRuns); err != nil {
+				color.New(color.FgRed).Printf("Error rotating result files: %v\n", err)
+			}
+		}
+
+		mu.Lock()
+		current = nil
+		mu.Unlock()
+	})
+}
\ No newline at end of file
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/fatih/color"
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/api"
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/config"
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/metrics"
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/scanner"
+)
+
+func startAPI(settings *config.Settings, pool api.PoolSource) *api.Server {
+	server := api.New(settings.API, config.GetCloudflareRanges(), scanner.LoadHistory(historyFile), pool)
+	go func() {
+		if err := server.ListenAndServe(); err != nil {
+			color.New(color.FgRed).Printf("API server stopped: %v\n", err)
+			os.Exit(1)
+		}
+	}()
+	color.New(color.FgCyan).Printf("API listening on http://%s\n", settings.API.Listen)
+	return server
+}
+
+func startMetrics(settings *config.Settings) *metrics.Collector {
+	collector := metrics.New()
+	go func() {
+		if err := collector.ListenAndServe(settings.Metrics.Listen); err != nil {
+			color.New(color.FgRed).Printf("Metrics server stopped: %v\n", err)
+		}
+	}()
+	color.New(color.FgCyan).Printf("Metrics available at http://%s/metrics\n", settings.Metrics.Listen)
+	return collector
+}
+
+func runServe(settings *config.Settings) {
+	scanner.SetProgressBars(false)
+	if settings.Metrics.Enabled {
+		startMetrics(settings)
+	}
+	server := startAPI(settings, nil)
+	if settings.Resolver.DNSEnabled {
+		startResolver(settings, func() []scanner.IPResult { return server.Best(0) })
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	color.New(color.FgCyan).Println("Waiting for requests. Press Ctrl+C to stop.")
+	<-sigChan
+
+	color.New(color.FgYellow, color.Bold).Println("Interrupt received. Stopping server...")
+	server.StopScan()
+}
\ No newline at end of file
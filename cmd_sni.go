@@ -0,0 +1,34 @@
+package main
+
+import (
+	"github.com/fatih/color"
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/config"
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/scanner"
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/utils"
+)
+
+const sniResultsFile = "sni_results.txt"
+
+// runSNISweep checks which server names work on the IPs given as arguments,
+// or on the best responsive IPs of a fresh latency scan when none are given.
+func runSNISweep(settings *config.Settings, args []string) {
+	c := settings.Scanner.SNI
+
+	sw := newSweep("SNI sweep")
+	ips := sw.ips(args, c.TopIPs)
+	if len(ips) == 0 {
+		return
+	}
+
+	sweepStop := sw.start()
+	names := scanner.SNIList(c)
+	color.New(color.FgCyan).Printf("\nTrying %d SNI(s) on %d IP(s)\n", len(names), len(ips))
+	results := scanner.SweepSNI(sweepStop, ips, c)
+
+	utils.PrintSNIResults(results)
+	if err := utils.SaveSNIResults(results, sniResultsFile); err != nil {
+		color.New(color.FgRed).Printf("Error saving file: %v\n", err)
+	} else {
+		color.New(color.FgGreen).Printf("SNI results saved to %s\n", sniResultsFile)
+	}
+}
\ No newline at end of file
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"os"
+
+	"github.com/fatih/color"
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/config"
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/speedserver"
+)
+
+// runSpeedServer serves speed test payloads so scans can measure against
+// the user's own domain instead of speed.cloudflare.com.
+func runSpeedServer(settings *config.Settings) {
+	o := settings.SpeedServer
+	server := speedserver.New(o)
+
+	scheme := "http"
+	if server.TLS() {
+		scheme = "https"
+	}
+	cyan := color.New(color.FgCyan)
+	cyan.Printf("Speed server listening on %s://%s\n", scheme, o.Listen)
+	cyan.Println("  GET  /__down?bytes=N   download N bytes")
+	cyan.Println("  POST /__up             upload, the body is discarded")
+	cyan.Println("  GET  /generate_204     empty response for latency probes")
+	color.New(color.FgYellow).Println(`Point "scanner.speed.url" in settings.json at https://<your domain>/__down on a domain proxied by Cloudflare.`)
+
+	if err := server.ListenAndServe(); err != nil {
+		color.New(color.FgRed).Printf("Speed server stopped: %v\n", err)
+		os.Exit(1)
+	}
+}
\ No newline at end of file
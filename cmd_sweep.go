@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/fatih/color"
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/config"
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/scanner"
+)
+
+// sweep holds what the sweep commands share: the IPs come from the
+// arguments or from a latency scan that the first interrupt cuts short,
+// and a later interrupt stops the sweep itself. Once the sweep is stopped
+// further interrupts end the program as usual.
+type sweep struct {
+	name     string
+	pingStop chan struct{}
+	stop     chan struct{}
+	pingOnce sync.Once
+	stopOnce sync.Once
+
+	mu       sync.Mutex
+	sweeping bool
+}
+
+func newSweep(name string) *sweep {
+	s := &sweep{
+		name:     name,
+		pingStop: make(chan struct{}),
+		stop:     make(chan struct{}),
+	}
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		for range sigChan {
+			s.interrupt()
+		}
+	}()
+	return s
+}
+
+func (s *sweep) interrupt() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.sweeping {
+		s.pingOnce.Do(func() {
+			color.New(color.FgYellow, color.Bold).Println("\nInterrupt received. Continuing with IPs found so far...")
+			close(s.pingStop)
+		})
+		return
+	}
+	s.stopOnce.Do(func() {
+		color.New(color.FgYellow, color.Bold).Printf("\nInterrupt received. Stopping %s...\n", s.name)
+		signal.Reset(os.Interrupt, syscall.SIGTERM)
+		close(s.stop)
+	})
+}
+
+// ips parses args as IP addresses, exiting on an invalid one. Without
+// arguments it runs a latency scan and returns up to topIPs of the
+// responsive IPs, or all of them when topIPs is 0.
+func (s *sweep) ips(args []string, topIPs int) []*net.IPAddr {
+	var ips []*net.IPAddr
+	for _, arg := range args {
+		ip := net.ParseIP(arg)
+		if ip == nil {
+			color.New(color.FgRed).Printf("Invalid IP address: %s\n", arg)
+			os.Exit(1)
+		}
+		ips = append(ips, &net.IPAddr{IP: ip})
+	}
+
+	if len(ips) == 0 {
+		color.New(color.FgCyan).Printf("Finding responsive IPs for the %s...\n", s.name)
+		pingResults := scanner.PingIPs(s.pingStop, scanner.GenerateIPs(config.GetCloudflareRanges()))
+		for i, pr := range pingResults {
+			if topIPs > 0 && i >= topIPs {
+				break
+			}
+			ips = append(ips, pr.IP)
+		}
+	}
+	if len(ips) == 0 {
+		color.New(color.FgRed, color.Bold).Println("No responsive IPs found!")
+	}
+	return ips
+}
+
+// start switches interrupts from the latency scan to the sweep and returns
+// the channel that is closed when the sweep should stop.
+func (s *sweep) start() <-chan struct{} {
+	s.mu.Lock()
+	s.sweeping = true
+	s.mu.Unlock()
+	return s.stop
+}
\ No newline at end of file
@@ -0,0 +1,12 @@
+package main
+
+import (
+	"github.com/fatih/color"
+)
+
+// runValidate checks config/xray_config.json the same way Xray mode does
+// before a scan; checkXrayFiles exits non-zero if the config is unusable.
+func runValidate() {
+	checkXrayFiles()
+	color.New(color.FgGreen, color.Bold).Println("config/xray_config.json is ready for Xray mode.")
+}
\ No newline at end of file
@@ -8,14 +8,20 @@ import (
 	"strings"
 )
 
-func GetCloudflareRanges() []string {
+func configFilePath(name string) (string, error) {
 	exe, err := os.Executable()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: could not determine executable path: %v\n", err)
+		return "", fmt.Errorf("could not determine executable path: %v", err)
+	}
+	return filepath.Join(filepath.Dir(exe), "config", name), nil
+}
+
+func GetCloudflareRanges() []string {
+	filePath, err := configFilePath("ip_ranges.txt")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
-	exeDir := filepath.Dir(exe)
-	filePath := filepath.Join(exeDir, "config", "ip_ranges.txt")
 
 	file, err := os.Open(filePath)
 	if err != nil {
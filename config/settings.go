@@ -0,0 +1,73 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/api"
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/daemon"
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/dashboard"
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/metrics"
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/notify"
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/publish"
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/resolver"
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/schedule"
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/scanner"
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/speedserver"
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/utils"
+)
+
+const settingsFile = "settings.json"
+
+type Settings struct {
+	Scanner     scanner.Options     `json:"scanner"`
+	Output      utils.OutputOptions `json:"output"`
+	Dashboard   dashboard.Options   `json:"dashboard"`
+	Daemon      daemon.Options      `json:"daemon"`
+	API         api.Options         `json:"api"`
+	Metrics     metrics.Options     `json:"metrics"`
+	Publish     publish.Options     `json:"publish"`
+	Resolver    resolver.Options    `json:"resolver"`
+	Notify      notify.Options      `json:"notify"`
+	Schedule    schedule.Options    `json:"schedule"`
+	SpeedServer speedserver.Options `json:"speed_server"`
+}
+
+func DefaultSettings() *Settings {
+	return &Settings{
+		Scanner:     scanner.DefaultOptions(),
+		Dashboard:   dashboard.DefaultOptions(),
+		Daemon:      daemon.DefaultOptions(),
+		API:         api.DefaultOptions(),
+		Metrics:     metrics.DefaultOptions(),
+		Publish:     publish.DefaultOptions(),
+		Resolver:    resolver.DefaultOptions(),
+		Notify:      notify.DefaultOptions(),
+		Schedule:    schedule.DefaultOptions(),
+		SpeedServer: speedserver.DefaultOptions(),
+	}
+}
+
+// LoadSettings reads config/settings.json next to the executable. Fields
+// missing from the file keep their default values, and a missing file is
+// not an error.
+func LoadSettings() (*Settings, error) {
+	s := DefaultSettings()
+
+	filePath, err := configFilePath(settingsFile)
+	if err != nil {
+		return s, err
+	}
+	data, err := os.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return s, fmt.Errorf("cannot read %s: %v", filePath, err)
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return DefaultSettings(), fmt.Errorf("invalid JSON in %s: %v", filePath, err)
+	}
+	return s, nil
+}
\ No newline at end of file
@@ -0,0 +1,279 @@
+package daemon
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/scanner"
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/utils"
+)
+
+type Options struct {
+	Mode             string  `json:"mode"`
+	PoolSize         int     `json:"pool_size"`
+	RefillThreshold  int     `json:"refill_threshold"`
+	CheckIntervalSec int     `json:"check_interval_sec"`
+	RefillSampleSize int     `json:"refill_sample_size"`
+	MaxFailures      int     `json:"max_failures"`
+	MinScore         float64 `json:"min_score"`
+	PoolFile         string  `json:"pool_file"`
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Mode:             "normal",
+		PoolSize:         10,
+		RefillThreshold:  5,
+		CheckIntervalSec: 300,
+		RefillSampleSize: 2000,
+		MaxFailures:      2,
+		PoolFile:         "pool_ips.txt",
+	}
+}
+
+type member struct {
+	result      scanner.IPResult
+	failures    int
+	checks      int
+	passes      int
+	added       time.Time
+	lastChecked time.Time
+}
+
+// Daemon keeps a pool of healthy IPs alive: members are re-probed on every
+// cycle, evicted once they degrade, and the pool is refilled from a random
+// sample of the configured ranges when it shrinks below the threshold.
+type Daemon struct {
+	opts   Options
+	ranges []string
+
+	pingFn  func(<-chan struct{}, []*net.IPAddr) []scanner.PingResult
+	speedFn func(<-chan struct{}, []scanner.PingResult, scanner.SpeedConfig) []scanner.IPResult
+
+	mu    sync.Mutex
+	pool  map[string]*member
+	hooks []func(pool []scanner.IPResult)
+}
+
+func New(opts Options, ranges []string) *Daemon {
+	d := &Daemon{
+		opts:    opts,
+		ranges:  ranges,
+		pingFn:  scanner.PingIPs,
+		speedFn: scanner.SpeedTestWith,
+		pool:    make(map[string]*member),
+	}
+	if opts.MaxFailures <= 0 {
+		d.opts.MaxFailures = DefaultOptions().MaxFailures
+	}
+	if opts.Mode == "xray" {
+		d.pingFn = scanner.PingIPsViaXray
+		d.speedFn = scanner.SpeedTestViaXrayWith
+	}
+	return d
+}
+
+// Pool returns the current healthy IPs, best first.
+func (d *Daemon) Pool() []scanner.IPResult {
+	d.mu.Lock()
+	results := make([]scanner.IPResult, 0, len(d.pool))
+	for _, m := range d.pool {
+		results = append(results, m.result)
+	}
+	d.mu.Unlock()
+
+	scanner.SortResults(results)
+	return results
+}
+
+// OnCycle registers fn to be called with the pool after every completed
+// maintenance cycle.
+func (d *Daemon) OnCycle(fn func(pool []scanner.IPResult)) {
+	d.mu.Lock()
+	d.hooks = append(d.hooks, fn)
+	d.mu.Unlock()
+}
+
+func (d *Daemon) Size() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.pool)
+}
+
+func stopped(stopCh <-chan struct{}) bool {
+	select {
+	case <-stopCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// Run executes maintenance cycles until stopCh is closed.
+func (d *Daemon) Run(stopCh <-chan struct{}) {
+	interval := time.Duration(d.opts.CheckIntervalSec) * time.Second
+	if interval <= 0 {
+		interval = time.Duration(DefaultOptions().CheckIntervalSec) * time.Second
+	}
+
+	for {
+		d.cycle(stopCh)
+		if stopped(stopCh) {
+			return
+		}
+
+		select {
+		case <-stopCh:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (d *Daemon) cycle(stopCh <-chan struct{}) {
+	release := scanner.Exclusive()
+	start := time.Now()
+	evicted := d.recheck(stopCh)
+	added := 0
+	if !stopped(stopCh) && (d.Size() < d.opts.RefillThreshold || d.Size() == 0) {
+		added = d.refill(stopCh)
+	}
+	release()
+	if stopped(stopCh) {
+		return
+	}
+
+	pool := d.Pool()
+	if d.opts.PoolFile != "" {
+		if err := utils.SaveResults(pool, d.opts.PoolFile); err != nil {
+			color.New(color.FgRed).Printf("Error saving pool: %v\n", err)
+		}
+	}
+
+	color.New(color.FgGreen).Printf("[%s] Pool: %d/%d healthy IPs (evicted %d, added %d) in %s\n",
+		time.Now().Format("2006-01-02 15:04:05"), len(pool), d.opts.PoolSize, evicted, added,
+		time.Since(start).Truncate(time.Second))
+
+	d.mu.Lock()
+	hooks := d.hooks
+	d.mu.Unlock()
+	for _, fn := range hooks {
+		fn(pool)
+	}
+}
+
+// recheck probes every pool member again, re-runs the speed test on those
+// that still answer and returns how many members were evicted. A member
+// that fails either test counts a failure and is evicted after
+// MaxFailures in a row; one that passes but no longer meets the filters or
+// MinScore is evicted at once.
+func (d *Daemon) recheck(stopCh <-chan struct{}) int {
+	d.mu.Lock()
+	ips := make([]*net.IPAddr, 0, len(d.pool))
+	for _, m := range d.pool {
+		ips = append(ips, m.result.IP)
+	}
+	d.mu.Unlock()
+
+	if len(ips) == 0 {
+		return 0
+	}
+
+	pingResults := d.pingFn(stopCh, ips)
+	if stopped(stopCh) {
+		return 0
+	}
+	var speedResults []scanner.IPResult
+	if len(pingResults) > 0 {
+		c := scanner.CurrentOptions().Speed
+		c.Wanted, c.MaxTest = len(pingResults), 0
+		speedResults = d.speedFn(stopCh, pingResults, c)
+		if stopped(stopCh) {
+			return 0
+		}
+	}
+
+	byIP := make(map[string]scanner.IPResult, len(speedResults))
+	for _, r := range speedResults {
+		byIP[r.IP.String()] = r
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	evicted := 0
+	for key, m := range d.pool {
+		m.lastChecked = now
+		m.checks++
+		r, ok := byIP[key]
+		if !ok {
+			m.failures++
+		} else {
+			m.passes++
+			// Keep what the recheck does not measure.
+			r.Tunnel = m.result.Tunnel
+			m.result = r
+			m.failures = 0
+		}
+		m.result.Stability = float64(m.passes) / float64(m.checks)
+		m.result.Score = scanner.ScoreOf(m.result)
+
+		degraded := !scanner.CurrentOptions().Scoring.Passes(m.result) || m.result.Score < d.opts.MinScore
+		if m.failures >= d.opts.MaxFailures || (ok && degraded) {
+			delete(d.pool, key)
+			evicted++
+		}
+	}
+	return evicted
+}
+
+// refill scans a random sample of the ranges and adds the best new IPs
+// until the pool is full again. It returns how many IPs were added.
+func (d *Daemon) refill(stopCh <-chan struct{}) int {
+	need := d.opts.PoolSize - d.Size()
+	if need <= 0 {
+		return 0
+	}
+
+	color.New(color.FgCyan).Printf("Pool below threshold, scanning %d random IPs to refill %d slot(s)\n",
+		d.opts.RefillSampleSize, need)
+
+	ips := scanner.SampleIPs(d.ranges, d.opts.RefillSampleSize)
+	pingResults := d.pingFn(stopCh, ips)
+	if stopped(stopCh) || len(pingResults) == 0 {
+		return 0
+	}
+
+	d.mu.Lock()
+	candidates := pingResults[:0]
+	for _, pr := range pingResults {
+		if _, ok := d.pool[pr.IP.String()]; !ok {
+			candidates = append(candidates, pr)
+		}
+	}
+	d.mu.Unlock()
+
+	c := scanner.CurrentOptions().Speed
+	c.Wanted = need
+	results := d.speedFn(stopCh, candidates, c)
+	if stopped(stopCh) {
+		return 0
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	added := 0
+	for _, r := range scanner.TopResults(results, need) {
+		if r.Score < d.opts.MinScore {
+			continue
+		}
+		d.pool[r.IP.String()] = &member{result: r, added: now, lastChecked: now}
+		added++
+	}
+	return added
+}
\ No newline at end of file
@@ -0,0 +1,359 @@
+package dashboard
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/scanner"
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/utils"
+	"golang.org/x/sys/unix"
+	"golang.org/x/term"
+)
+
+// keyPollMs is how often readKeys looks up from waiting for a key to see
+// whether the dashboard was stopped.
+const keyPollMs = 100
+
+type Options struct {
+	Enabled    bool   `json:"enabled"`
+	RefreshMs  int    `json:"refresh_ms"`
+	TopN       int    `json:"top_n"`
+	ExportFile string `json:"export_file"`
+}
+
+func DefaultOptions() Options {
+	return Options{
+		RefreshMs:  500,
+		TopN:       15,
+		ExportFile: "clean_ips_live.txt",
+	}
+}
+
+// Controls are the actions the dashboard can trigger in the running scan.
+type Controls struct {
+	StopPing  func()
+	Interrupt func()
+}
+
+var phaseNames = map[scanner.Phase]string{
+	scanner.PhasePing:      "Latency test (TCP)",
+	scanner.PhaseSpeed:     "Download speed test",
+	scanner.PhaseXrayPing:  "Latency test (Xray)",
+	scanner.PhaseXraySpeed: "Download speed test (Xray)",
+	scanner.PhaseSNI:       "SNI sweep",
+}
+
+type Dashboard struct {
+	opts     Options
+	controls Controls
+
+	mu         sync.Mutex
+	start      time.Time
+	phase      scanner.Phase
+	total      int
+	done       int
+	found      int
+	probes     int64
+	lastProbes int64
+	lastTick   time.Time
+	rate       float64
+	bytes      int64
+	failures   map[string]int
+	best       map[string]scanner.IPResult
+	status     string
+
+	unsubscribe   func()
+	oldState      *term.State
+	oldOutput     io.Writer
+	oldScanOutput io.Writer
+	keys          int
+	quit          chan struct{}
+	wg            sync.WaitGroup
+	stopOnce      sync.Once
+}
+
+// Start switches the terminal to a full-screen view of the running scan.
+// It fails if stdin is not a terminal.
+func Start(opts Options, controls Controls) (*Dashboard, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, fmt.Errorf("dashboard needs an interactive terminal")
+	}
+	keys, err := syscall.Dup(fd)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the keyboard: %v", err)
+	}
+	oldState, err := term.MakeRaw(fd)
+	if err != nil {
+		syscall.Close(keys)
+		return nil, fmt.Errorf("cannot switch terminal to raw mode: %v", err)
+	}
+	if opts.RefreshMs <= 0 {
+		opts.RefreshMs = DefaultOptions().RefreshMs
+	}
+	if opts.TopN <= 0 {
+		opts.TopN = DefaultOptions().TopN
+	}
+
+	d := &Dashboard{
+		opts:          opts,
+		controls:      controls,
+		start:         time.Now(),
+		lastTick:      time.Now(),
+		failures:      make(map[string]int),
+		best:          make(map[string]scanner.IPResult),
+		oldState:      oldState,
+		oldOutput:     color.Output,
+		oldScanOutput: scanner.Output(),
+		keys:          keys,
+		quit:          make(chan struct{}),
+	}
+
+	color.Output = io.Discard
+	scanner.SetOutput(io.Discard)
+	scanner.SetProgressBars(false)
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+
+	d.unsubscribe = scanner.Subscribe(d.handleEvent)
+
+	d.wg.Add(2)
+	go d.renderLoop()
+	go d.readKeys()
+
+	return d, nil
+}
+
+// Stop restores the terminal. It is safe to call more than once.
+func (d *Dashboard) Stop() {
+	if d == nil {
+		return
+	}
+	d.stopOnce.Do(func() {
+		d.unsubscribe()
+		close(d.quit)
+		d.wg.Wait()
+		syscall.Close(d.keys)
+
+		fd := int(os.Stdin.Fd())
+		fmt.Print("\x1b[?25h\x1b[?1049l")
+		term.Restore(fd, d.oldState)
+		color.Output = d.oldOutput
+		scanner.SetOutput(d.oldScanOutput)
+		scanner.SetProgressBars(true)
+	})
+}
+
+func (d *Dashboard) handleEvent(e scanner.Event) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	switch e.Type {
+	case scanner.EventPhaseStart:
+		d.phase = e.Phase
+		d.total = e.Total
+		d.done = 0
+		d.found = 0
+	case scanner.EventProbe:
+		d.probes++
+		if e.Err != nil {
+			d.failures[string(scanner.ClassifyError(e.Err))]++
+		}
+	case scanner.EventIPDone:
+		d.done++
+		key := e.IP.String()
+		if e.Result != nil {
+			d.found++
+			d.best[key] = *e.Result
+		} else if e.Phase == scanner.PhaseSpeed || e.Phase == scanner.PhaseXraySpeed {
+			delete(d.best, key)
+		}
+	case scanner.EventBytes:
+		d.bytes += e.Bytes
+	}
+}
+
+func (d *Dashboard) topResults(n int) []scanner.IPResult {
+	d.mu.Lock()
+	results := make([]scanner.IPResult, 0, len(d.best))
+	for _, r := range d.best {
+		results = append(results, r)
+	}
+	d.mu.Unlock()
+
+	scanner.SortResults(results)
+	if len(results) > n {
+		results = results[:n]
+	}
+	return results
+}
+
+func (d *Dashboard) setStatus(format string, args ...interface{}) {
+	d.mu.Lock()
+	d.status = fmt.Sprintf(format, args...)
+	d.mu.Unlock()
+}
+
+// readKeys reads keypresses from a copy of stdin. It only reads once poll
+// says a key is waiting, so it notices Stop within keyPollMs instead of
+// leaving a blocked read behind to swallow the next keypress after the
+// dashboard is gone.
+func (d *Dashboard) readKeys() {
+	defer d.wg.Done()
+	buf := make([]byte, 1)
+	fds := []unix.PollFd{{Fd: int32(d.keys), Events: unix.POLLIN}}
+	for {
+		select {
+		case <-d.quit:
+			return
+		default:
+		}
+		ready, err := unix.Poll(fds, keyPollMs)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return
+		}
+		if ready == 0 {
+			continue
+		}
+		n, err := syscall.Read(d.keys, buf)
+		if err != nil || n == 0 {
+			return
+		}
+		select {
+		case <-d.quit:
+			return
+		default:
+		}
+
+		switch buf[0] {
+		case 's', 'S':
+			d.setStatus("Stopping latency test...")
+			d.controls.StopPing()
+		case 'n', 'N':
+			d.setStatus("Skipping current IP...")
+			scanner.SkipCurrent()
+		case 'e', 'E':
+			top := d.topResults(d.opts.TopN)
+			if err := utils.SaveResults(top, d.opts.ExportFile); err != nil {
+				d.setStatus("Export failed: %v", err)
+			} else {
+				d.setStatus("Exported %d IP(s) to %s", len(top), d.opts.ExportFile)
+			}
+		case 'q', 'Q', 3:
+			d.setStatus("Stopping...")
+			d.controls.Interrupt()
+		}
+	}
+}
+
+func (d *Dashboard) renderLoop() {
+	defer d.wg.Done()
+	ticker := time.NewTicker(time.Duration(d.opts.RefreshMs) * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		d.render()
+		select {
+		case <-d.quit:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *Dashboard) render() {
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || width <= 0 || height <= 0 {
+		width, height = 80, 24
+	}
+	rows := d.opts.TopN
+	if max := height - 14; rows > max {
+		rows = max
+	}
+	if rows < 1 {
+		rows = 1
+	}
+	top := d.topResults(rows)
+
+	d.mu.Lock()
+	now := time.Now()
+	if dt := now.Sub(d.lastTick).Seconds(); dt > 0 {
+		d.rate = float64(d.probes-d.lastProbes) / dt
+	}
+	d.lastProbes = d.probes
+	d.lastTick = now
+
+	var b strings.Builder
+	line := func(format string, args ...interface{}) {
+		s := fmt.Sprintf(format, args...)
+		if len(s) > width {
+			s = s[:width]
+		}
+		b.WriteString(s + "\x1b[K\r\n")
+	}
+
+	b.WriteString("\x1b[H")
+	line("CF Clean IP Scanner - live dashboard          Elapsed: %s", now.Sub(d.start).Truncate(time.Second))
+	line("%s", strings.Repeat("=", min(width, 78)))
+
+	name := phaseNames[d.phase]
+	if name == "" {
+		name = "Starting..."
+	}
+	pct := 0.0
+	if d.total > 0 {
+		pct = float64(d.done) / float64(d.total) * 100
+	}
+	barWidth := 30
+	filled := int(pct / 100 * float64(barWidth))
+	line("Phase   : %s", name)
+	line("Progress: [%s%s] %d / %d (%.1f%%)  Found: %d",
+		strings.Repeat("#", filled), strings.Repeat("-", barWidth-filled), d.done, d.total, pct, d.found)
+	line("Probes  : %.0f/s   Data used: %.2f MB", d.rate, float64(d.bytes)/1024/1024)
+	line("Errors  : %s", formatFailures(d.failures))
+	status := d.status
+	d.mu.Unlock()
+
+	line("%s", strings.Repeat("-", min(width, 78)))
+	line("%-5s %-28s %-6s %-8s %-8s %-12s %-6s", "Rank", "IP Address", "Loss", "Delay", "Jitter", "Speed", "Score")
+	for i, r := range top {
+		line("%-5s %-28s %-6.2f %-8s %-8s %-12s %-6.1f",
+			fmt.Sprintf("%d.", i+1), r.IP.String(), r.LossRate,
+			fmt.Sprintf("%dms", r.Delay), fmt.Sprintf("%dms", r.Jitter),
+			fmt.Sprintf("%.2f MB/s", r.DownloadSpeed/1024/1024), r.Score)
+	}
+	for i := len(top); i < rows; i++ {
+		line("")
+	}
+	line("%s", strings.Repeat("-", min(width, 78)))
+	line("[s] stop latency test  [n] skip IP  [e] export top list  [q] stop scan")
+	line("%s", status)
+	b.WriteString("\x1b[J")
+
+	os.Stdout.WriteString(b.String())
+}
+
+func formatFailures(failures map[string]int) string {
+	if len(failures) == 0 {
+		return "none"
+	}
+	keys := make([]string, 0, len(failures))
+	for k := range failures {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s %d", k, failures[k]))
+	}
+	return strings.Join(parts, "  ")
+}
\ No newline at end of file
@@ -3,16 +3,22 @@ module github.com/4n0nymou3/CF-Clean-IP-Scanner
 go 1.23
 
 require (
-	github.com/VividCortex/ewma v1.2.0
 	github.com/cheggaaa/pb/v3 v3.1.5
 	github.com/fatih/color v1.18.0
+	github.com/refraction-networking/utls v1.6.7
 	golang.org/x/net v0.30.0
+	golang.org/x/sys v0.26.0
+	golang.org/x/term v0.25.0
 )
 
 require (
+	github.com/VividCortex/ewma v1.2.0 // indirect
+	github.com/andybalholm/brotli v1.0.6 // indirect
+	github.com/cloudflare/circl v1.3.7 // indirect
+	github.com/klauspost/compress v1.17.4 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
 	github.com/mattn/go-runewidth v0.0.15 // indirect
 	github.com/rivo/uniseg v0.2.0 // indirect
-	golang.org/x/sys v0.25.0 // indirect
-)
\ No newline at end of file
+	golang.org/x/crypto v0.28.0 // indirect
+)
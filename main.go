@@ -2,21 +2,27 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"os"
 	"os/signal"
 	"strings"
-	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/fatih/color"
 	"github.com/4n0nymou3/CF-Clean-IP-Scanner/config"
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/dashboard"
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/notify"
 	"github.com/4n0nymou3/CF-Clean-IP-Scanner/scanner"
 	"github.com/4n0nymou3/CF-Clean-IP-Scanner/utils"
 )
 
-const version = "2.1.1"
+const (
+	version     = "2.1.1"
+	topCount    = 10
+	historyFile = "scan_history.json"
+)
 
 func formatDuration(d time.Duration) string {
 	h := int(d.Hours())
@@ -40,143 +46,99 @@ func printScanStats(elapsed time.Duration, interrupted bool) {
 	fmt.Println()
 }
 
-func askScanMode() int {
-	reader := bufio.NewReader(os.Stdin)
-	for {
-		fmt.Println()
-		color.New(color.FgCyan, color.Bold).Println("Select scan mode:")
-		color.New(color.FgWhite).Println("  [1] Normal scan (TCP ping + speed test)")
-		color.New(color.FgWhite).Println("  [2] Xray scan (uses Xray core with your config)")
-		fmt.Print("Enter 1 or 2: ")
-		input, _ := reader.ReadString('\n')
-		input = strings.TrimSpace(input)
-		if input == "1" {
-			return 1
-		} else if input == "2" {
-			if _, err := os.Stat("./xray/xray"); os.IsNotExist(err) {
-				color.New(color.FgRed).Println("Error: Xray binary not found. Please reinstall the tool.")
-				os.Exit(1)
-			}
-			if _, err := os.Stat("./config/xray_config.json"); os.IsNotExist(err) {
-				color.New(color.FgRed).Println("Error: Xray config not found at config/xray_config.json")
-				color.New(color.FgYellow).Println("Please edit the sample config file first.")
-				os.Exit(1)
-			}
-			return 2
-		} else {
-			color.New(color.FgRed).Println("Invalid choice. Please enter 1 or 2.")
-		}
+func checkXrayFiles() {
+	if _, err := os.Stat("./xray/xray"); os.IsNotExist(err) {
+		color.New(color.FgRed).Println("Error: Xray binary not found. Please reinstall the tool.")
+		os.Exit(1)
+	}
+	if _, err := os.Stat("./config/xray_config.json"); os.IsNotExist(err) {
+		color.New(color.FgRed).Println("Error: Xray config not found at config/xray_config.json")
+		color.New(color.FgYellow).Println("Please edit the sample config file first.")
+		os.Exit(1)
 	}
-}
-
-func main() {
-	utils.PrintHeader()
-	utils.PrintDesigner()
 
-	cyan := color.New(color.FgCyan)
-	cyan.Printf("Version: %s\n", version)
+	color.New(color.FgCyan).Println("Checking config/xray_config.json...")
+	checks := scanner.ValidateXrayConfig(true)
+	utils.PrintValidation(checks)
 	fmt.Println()
+	if scanner.ValidationFailed(checks) {
+		color.New(color.FgRed).Println("Error: config/xray_config.json cannot be used for testing. Fix the problems above and try again.")
+		os.Exit(1)
+	}
 
-	color.New(color.FgYellow).Println("Optimized for Iran network conditions")
-	color.New(color.FgYellow).Println("Press Ctrl+C at any time to stop and see results found so far.")
+	changes, err := scanner.XrayConfigChanges()
+	if err != nil {
+		color.New(color.FgRed).Printf("Error: config/xray_config.json cannot be used for testing: %v\n", err)
+		os.Exit(1)
+	}
+	color.New(color.FgCyan).Println("Each IP is tested with a copy of your Xray config where:")
+	for _, c := range changes {
+		color.New(color.FgWhite).Printf("  - %s\n", c)
+	}
 	fmt.Println()
+}
 
-	mode := askScanMode()
-
-	time.Sleep(500 * time.Millisecond)
-
-	stopPingCh := make(chan struct{})
-	stopSpeedCh := make(chan struct{})
-	inSpeedPhase := int32(0)
-
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+func applyResults(results []scanner.IPResult) {
+	if _, err := os.Stat("./config/xray_config.json"); os.IsNotExist(err) {
+		color.New(color.FgYellow).Println("Skipping apply: config/xray_config.json not found.")
+		return
+	}
+	ips := make([]string, len(results))
+	for i, r := range results {
+		ips[i] = r.IP.String()
+	}
+	applied, err := scanner.ApplyIPs(ips, scanner.CurrentOptions().Apply)
+	if err != nil {
+		color.New(color.FgRed).Printf("Error applying IPs to Xray config: %v\n", err)
+		return
+	}
+	if applied.BackupPath != "" {
+		color.New(color.FgGreen).Printf("Original config backed up to %s\n", applied.BackupPath)
+	}
+	color.New(color.FgGreen).Printf("Xray config updated with %s\n", strings.Join(applied.IPs, ", "))
+}
 
-	go func() {
-		for {
-			<-sigChan
-			fmt.Println()
-			if atomic.LoadInt32(&inSpeedPhase) == 0 {
-				color.New(color.FgYellow, color.Bold).Println("Interrupt received. Stopping ping phase and proceeding to speed test with IPs found so far...")
-				select {
-				case <-stopPingCh:
-				default:
-					close(stopPingCh)
-				}
-			} else {
-				color.New(color.FgYellow, color.Bold).Println("Interrupt received. Stopping speed test and collecting results...")
-				signal.Reset(os.Interrupt)
-				select {
-				case <-stopSpeedCh:
-				default:
-					close(stopSpeedCh)
-				}
-				return
-			}
-		}
-	}()
+// outputFiles names the files a scan writes its results to.
+type outputFiles struct {
+	results string
+	list    string
+}
 
-	startTime := time.Now()
+var defaultOutput = outputFiles{results: "clean_ips.txt", list: "clean_ips_list.txt"}
 
+// runScan scans the configured ranges and handles everything that follows:
+// printing and saving results, history, and the optional apply, publish,
+// hosts-file and notification steps. dash may be nil.
+func runScan(settings *config.Settings, scan *scanner.Scan, dash *dashboard.Dashboard, out outputFiles, apply bool) *scanner.Report {
 	ipRanges := config.GetCloudflareRanges()
 	ips := scanner.GenerateIPs(ipRanges)
 
 	fmt.Println()
 
-	var pingResults []scanner.PingResult
-	var pingWasStopped bool
-
-	if mode == 1 {
-		pingResults = scanner.PingIPs(stopPingCh, ips)
-
-		select {
-		case <-stopPingCh:
-			pingWasStopped = true
-		default:
-		}
-	} else {
-		pingResults = scanner.PingIPsViaXray(stopPingCh, ips)
-
-		select {
-		case <-stopPingCh:
-			pingWasStopped = true
-		default:
-		}
+	history := scanner.LoadHistory(historyFile)
+	report := scan.Run(ips, history)
+	dash.Stop()
+	if err := history.Save(); err != nil {
+		color.New(color.FgRed).Printf("Error saving scan history: %v\n", err)
 	}
 
-	if pingWasStopped && len(pingResults) == 0 {
-		elapsed := time.Since(startTime)
+	pingResults := report.PingResults
+	results := report.Results
+	elapsed := report.Elapsed
+	interrupted := report.Interrupted
+
+	if report.PingStopped && len(pingResults) == 0 {
 		color.New(color.FgYellow).Println("Scan stopped during latency test. No responsive IPs found yet.")
 		printScanStats(elapsed, true)
-		return
+		return report
 	}
 
-	if !pingWasStopped && len(pingResults) == 0 {
+	if !report.PingStopped && len(pingResults) == 0 {
 		color.New(color.FgRed, color.Bold).Println("No responsive IPs found!")
 		fmt.Println()
 		color.New(color.FgYellow).Println("Try running again. Network conditions may vary.")
-		elapsed := time.Since(startTime)
 		printScanStats(elapsed, false)
-		return
-	}
-
-	fmt.Println()
-
-	atomic.StoreInt32(&inSpeedPhase, 1)
-	var results []scanner.IPResult
-	if mode == 1 {
-		results = scanner.SpeedTest(stopSpeedCh, pingResults)
-	} else {
-		results = scanner.SpeedTestViaXray(stopSpeedCh, pingResults)
-	}
-
-	elapsed := time.Since(startTime)
-
-	interrupted := false
-	select {
-	case <-stopSpeedCh:
-		interrupted = true
-	default:
+		return report
 	}
 
 	if len(results) == 0 {
@@ -189,13 +151,10 @@ func main() {
 			color.New(color.FgYellow).Println("Try running again at a different time.")
 		}
 		printScanStats(elapsed, interrupted)
-		return
+		return report
 	}
 
-	topResults := results
-	if len(results) > 10 {
-		topResults = results[:10]
-	}
+	topResults := scanner.TopResults(results, topCount)
 
 	if interrupted {
 		color.New(color.FgYellow, color.Bold).Printf(
@@ -204,18 +163,162 @@ func main() {
 
 	utils.PrintResults(topResults)
 
-	if err := utils.SaveResults(results, "clean_ips.txt"); err != nil {
+	if err := utils.SaveResults(results, out.results); err != nil {
 		color.New(color.FgRed).Printf("Error saving file: %v\n", err)
 	} else {
-		color.New(color.FgGreen).Println("Results saved to clean_ips.txt")
+		color.New(color.FgGreen).Printf("Results saved to %s\n", out.results)
 		color.New(color.FgGreen).Printf("Total clean IPs found: %d\n", len(results))
 	}
 
-	if err := utils.SaveSimpleResults(topResults, pingResults, "clean_ips_list.txt"); err != nil {
+	if err := utils.SaveSimpleResults(topResults, pingResults, out.list); err != nil {
 		color.New(color.FgRed).Printf("Error saving simple list: %v\n", err)
 	} else {
-		color.New(color.FgGreen).Println("Simple IP list saved to clean_ips_list.txt")
+		color.New(color.FgGreen).Printf("Simple IP list saved to %s\n", out.list)
+	}
+
+	if apply || settings.Scanner.Apply.Enabled {
+		applyResults(topResults)
+	}
+
+	if settings.Publish.Enabled {
+		publishResults(newPublisher(settings), settings, topResults)
+	}
+
+	writeHostsFile(settings, topResults)
+
+	if notifier := notify.New(settings.Notify); notifier.Enabled() {
+		if err := notifier.ScanComplete(string(report.Mode), elapsed, results); err != nil {
+			color.New(color.FgRed).Printf("Error sending notification: %v\n", err)
+		}
 	}
 
 	printScanStats(elapsed, interrupted)
+	return report
+}
+
+func askScanMode() int {
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Println()
+		color.New(color.FgCyan, color.Bold).Println("Select scan mode:")
+		color.New(color.FgWhite).Println("  [1] Normal scan (TCP ping + speed test)")
+		color.New(color.FgWhite).Println("  [2] Xray scan (uses Xray core with your config)")
+		color.New(color.FgWhite).Println("  [3] Combined scan (normal scan, then checks the clean IPs through Xray)")
+		fmt.Print("Enter 1, 2 or 3: ")
+		input, _ := reader.ReadString('\n')
+		input = strings.TrimSpace(input)
+		if input == "1" {
+			return 1
+		} else if input == "2" || input == "3" {
+			checkXrayFiles()
+			return int(input[0] - '0')
+		} else {
+			color.New(color.FgRed).Println("Invalid choice. Please enter 1, 2 or 3.")
+		}
+	}
+}
+
+func main() {
+	dashboardFlag := flag.Bool("dashboard", false, "show a live full-screen dashboard while scanning")
+	applyFlag := flag.Bool("apply", false, "write the best IP into config/xray_config.json after the scan")
+	flag.Parse()
+
+	utils.PrintHeader()
+	utils.PrintDesigner()
+
+	cyan := color.New(color.FgCyan)
+	cyan.Printf("Version: %s\n", version)
+	fmt.Println()
+
+	color.New(color.FgYellow).Println("Optimized for Iran network conditions")
+	color.New(color.FgYellow).Println("Press Ctrl+C at any time to stop and see results found so far.")
+	fmt.Println()
+
+	settings, err := config.LoadSettings()
+	if err != nil {
+		color.New(color.FgRed).Printf("Error loading settings: %v\n", err)
+		color.New(color.FgYellow).Println("Continuing with default settings.")
+	}
+	scanner.Configure(settings.Scanner)
+	utils.Configure(settings.Output)
+	if fp := settings.Scanner.TLS.Fingerprint; fp != "" && !scanner.KnownFingerprint(fp) {
+		color.New(color.FgYellow).Printf("Unknown TLS fingerprint %q, using Go's default ClientHello.\n", fp)
+	} else if fp := scanner.Fingerprint(); fp != "" {
+		cyan.Printf("TLS fingerprint: %s\n", fp)
+	}
+
+	switch flag.Arg(0) {
+	case "":
+	case "daemon":
+		runDaemon(settings)
+		return
+	case "serve":
+		runServe(settings)
+		return
+	case "schedule":
+		runSchedule(settings)
+		return
+	case "sni":
+		runSNISweep(settings, flag.Args()[1:])
+		return
+	case "fragment":
+		runFragmentSweep(settings, flag.Args()[1:])
+		return
+	case "validate":
+		runValidate()
+		return
+	case "speed-server":
+		runSpeedServer(settings)
+		return
+	default:
+		color.New(color.FgRed).Printf("Unknown command: %s\n", flag.Arg(0))
+		os.Exit(1)
+	}
+
+	mode := askScanMode()
+
+	time.Sleep(500 * time.Millisecond)
+
+	scanMode := scanner.ModeNormal
+	switch mode {
+	case 2:
+		scanMode = scanner.ModeXray
+	case 3:
+		scanMode = scanner.ModeCombined
+	}
+	scan := scanner.NewScan(scanMode)
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	interrupt := func() {
+		fmt.Fprintln(scanner.Output())
+		if !scan.InSpeedPhase() {
+			color.New(color.FgYellow, color.Bold).Println("Interrupt received. Stopping ping phase and proceeding to speed test with IPs found so far...")
+			scan.StopPing()
+		} else {
+			color.New(color.FgYellow, color.Bold).Println("Interrupt received. Stopping speed test and collecting results...")
+			signal.Reset(os.Interrupt)
+			scan.StopSpeed()
+		}
+	}
+
+	go func() {
+		for range sigChan {
+			interrupt()
+		}
+	}()
+
+	var dash *dashboard.Dashboard
+	if *dashboardFlag || settings.Dashboard.Enabled {
+		dash, err = dashboard.Start(settings.Dashboard, dashboard.Controls{
+			StopPing:  scan.StopPing,
+			Interrupt: interrupt,
+		})
+		if err != nil {
+			color.New(color.FgRed).Printf("Cannot start dashboard: %v\n", err)
+		}
+	}
+
+	runScan(settings, scan, dash, defaultOutput, *applyFlag)
 }
\ No newline at end of file
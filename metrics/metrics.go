@@ -0,0 +1,255 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/scanner"
+)
+
+type Options struct {
+	Enabled bool   `json:"enabled"`
+	Listen  string `json:"listen"`
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Listen: "127.0.0.1:9186",
+	}
+}
+
+var (
+	latencyBuckets = []float64{0.05, 0.1, 0.2, 0.3, 0.5, 0.75, 1, 2, 3, 5}
+	speedBuckets   = []float64{128 << 10, 256 << 10, 512 << 10, 1 << 20, 2 << 20, 5 << 20, 10 << 20, 20 << 20, 50 << 20}
+)
+
+type histogram struct {
+	bounds []float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+}
+
+func (h *histogram) observe(v float64) {
+	for i, b := range h.bounds {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+type probeKey struct {
+	phase  scanner.Phase
+	result string
+	reason string
+}
+
+type ipKey struct {
+	phase  scanner.Phase
+	result string
+}
+
+// Collector turns scan events into Prometheus metrics and serves them in
+// the text exposition format.
+type Collector struct {
+	mu           sync.Mutex
+	probes       map[probeKey]uint64
+	ips          map[ipKey]uint64
+	latency      map[scanner.Phase]*histogram
+	speed        map[scanner.Phase]*histogram
+	bytes        map[scanner.Phase]uint64
+	xrayStarts   uint64
+	xrayFailures uint64
+	poolSize     func() int
+}
+
+func New() *Collector {
+	c := &Collector{
+		probes:  make(map[probeKey]uint64),
+		ips:     make(map[ipKey]uint64),
+		latency: make(map[scanner.Phase]*histogram),
+		speed:   make(map[scanner.Phase]*histogram),
+		bytes:   make(map[scanner.Phase]uint64),
+	}
+	scanner.Subscribe(c.handleEvent)
+	return c
+}
+
+// SetPoolSize registers a function reporting the size of the healthy pool.
+func (c *Collector) SetPoolSize(fn func() int) {
+	c.mu.Lock()
+	c.poolSize = fn
+	c.mu.Unlock()
+}
+
+func (c *Collector) handleEvent(e scanner.Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch e.Type {
+	case scanner.EventProbe:
+		key := probeKey{phase: e.Phase, result: "success"}
+		if e.Err != nil {
+			key.result = "failure"
+			key.reason = string(scanner.ClassifyError(e.Err))
+		} else if e.Latency > 0 {
+			h, ok := c.latency[e.Phase]
+			if !ok {
+				h = newHistogram(latencyBuckets)
+				c.latency[e.Phase] = h
+			}
+			h.observe(e.Latency.Seconds())
+		}
+		c.probes[key]++
+
+	case scanner.EventIPDone:
+		key := ipKey{phase: e.Phase, result: "failure"}
+		if e.Result != nil {
+			key.result = "success"
+			if e.Phase == scanner.PhaseSpeed || e.Phase == scanner.PhaseXraySpeed {
+				h, ok := c.speed[e.Phase]
+				if !ok {
+					h = newHistogram(speedBuckets)
+					c.speed[e.Phase] = h
+				}
+				h.observe(e.Result.DownloadSpeed)
+			}
+		}
+		c.ips[key]++
+
+	case scanner.EventBytes:
+		c.bytes[e.Phase] += uint64(e.Bytes)
+
+	case scanner.EventXrayStart:
+		c.xrayStarts++
+		if e.Err != nil {
+			c.xrayFailures++
+		}
+	}
+}
+
+func labels(pairs ...string) string {
+	var parts []string
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if pairs[i+1] == "" {
+			continue
+		}
+		v := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(pairs[i+1])
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, pairs[i], v))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func header(b *strings.Builder, name, kind, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func writeHistograms(b *strings.Builder, name string, hs map[scanner.Phase]*histogram) {
+	phases := make([]string, 0, len(hs))
+	for p := range hs {
+		phases = append(phases, string(p))
+	}
+	sort.Strings(phases)
+	for _, p := range phases {
+		h := hs[scanner.Phase(p)]
+		for i, bound := range h.bounds {
+			fmt.Fprintf(b, "%s_bucket%s %d\n", name, labels("phase", p, "le", strconv.FormatFloat(bound, 'f', -1, 64)), h.counts[i])
+		}
+		fmt.Fprintf(b, "%s_bucket%s %d\n", name, labels("phase", p, "le", "+Inf"), h.count)
+		fmt.Fprintf(b, "%s_sum%s %g\n", name, labels("phase", p), h.sum)
+		fmt.Fprintf(b, "%s_count%s %d\n", name, labels("phase", p), h.count)
+	}
+}
+
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	var b strings.Builder
+
+	header(&b, "cfscanner_probes_total", "counter", "Probes sent, by phase, result and failure reason.")
+	probeKeys := make([]probeKey, 0, len(c.probes))
+	for k := range c.probes {
+		probeKeys = append(probeKeys, k)
+	}
+	sort.Slice(probeKeys, func(i, j int) bool {
+		a, z := probeKeys[i], probeKeys[j]
+		if a.phase != z.phase {
+			return a.phase < z.phase
+		}
+		if a.result != z.result {
+			return a.result < z.result
+		}
+		return a.reason < z.reason
+	})
+	for _, k := range probeKeys {
+		fmt.Fprintf(&b, "cfscanner_probes_total%s %d\n",
+			labels("phase", string(k.phase), "result", k.result, "reason", k.reason), c.probes[k])
+	}
+
+	header(&b, "cfscanner_ips_tested_total", "counter", "IPs that finished a phase, by result.")
+	ipKeys := make([]ipKey, 0, len(c.ips))
+	for k := range c.ips {
+		ipKeys = append(ipKeys, k)
+	}
+	sort.Slice(ipKeys, func(i, j int) bool {
+		if ipKeys[i].phase != ipKeys[j].phase {
+			return ipKeys[i].phase < ipKeys[j].phase
+		}
+		return ipKeys[i].result < ipKeys[j].result
+	})
+	for _, k := range ipKeys {
+		fmt.Fprintf(&b, "cfscanner_ips_tested_total%s %d\n",
+			labels("phase", string(k.phase), "result", k.result), c.ips[k])
+	}
+
+	header(&b, "cfscanner_probe_latency_seconds", "histogram", "Latency of successful probes.")
+	writeHistograms(&b, "cfscanner_probe_latency_seconds", c.latency)
+
+	header(&b, "cfscanner_download_speed_bytes_per_second", "histogram", "Measured download speed of IPs that passed the speed test.")
+	writeHistograms(&b, "cfscanner_download_speed_bytes_per_second", c.speed)
+
+	header(&b, "cfscanner_bytes_transferred_total", "counter", "Payload bytes downloaded and uploaded during speed tests.")
+	phases := make([]string, 0, len(c.bytes))
+	for p := range c.bytes {
+		phases = append(phases, string(p))
+	}
+	sort.Strings(phases)
+	for _, p := range phases {
+		fmt.Fprintf(&b, "cfscanner_bytes_transferred_total%s %d\n", labels("phase", p), c.bytes[scanner.Phase(p)])
+	}
+
+	header(&b, "cfscanner_xray_starts_total", "counter", "Attempts to launch the Xray core.")
+	fmt.Fprintf(&b, "cfscanner_xray_starts_total %d\n", c.xrayStarts)
+	header(&b, "cfscanner_xray_start_failures_total", "counter", "Xray core launches that failed.")
+	fmt.Fprintf(&b, "cfscanner_xray_start_failures_total %d\n", c.xrayFailures)
+
+	poolSize := c.poolSize
+	c.mu.Unlock()
+
+	if poolSize != nil {
+		header(&b, "cfscanner_pool_healthy_ips", "gauge", "IPs currently in the daemon's healthy pool.")
+		fmt.Fprintf(&b, "cfscanner_pool_healthy_ips %d\n", poolSize())
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write([]byte(b.String()))
+}
+
+// ListenAndServe serves the collector at /metrics on addr.
+func (c *Collector) ListenAndServe(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", c)
+	return http.ListenAndServe(addr, mux)
+}
\ No newline at end of file
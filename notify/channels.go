@@ -0,0 +1,181 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func postJSON(ctx context.Context, url string, headers map[string]string, body interface{}) (*http.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	return http.DefaultClient.Do(req)
+}
+
+type webhook struct {
+	opts WebhookOptions
+}
+
+func newWebhook(opts WebhookOptions) *webhook {
+	return &webhook{opts: opts}
+}
+
+func (w *webhook) Name() string { return "webhook" }
+
+func (w *webhook) Send(ctx context.Context, e *Event) error {
+	resp, err := postJSON(ctx, w.opts.URL, w.opts.Headers, e)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+type telegram struct {
+	opts TelegramOptions
+}
+
+func newTelegram(opts TelegramOptions) *telegram {
+	if opts.BaseURL == "" {
+		opts.BaseURL = DefaultOptions().Telegram.BaseURL
+	}
+	opts.BaseURL = strings.TrimRight(opts.BaseURL, "/")
+	return &telegram{opts: opts}
+}
+
+func (t *telegram) Name() string { return "telegram" }
+
+func (t *telegram) Send(ctx context.Context, e *Event) error {
+	url := fmt.Sprintf("%s/bot%s/sendMessage", t.opts.BaseURL, t.opts.BotToken)
+	resp, err := postJSON(ctx, url, nil, map[string]interface{}{
+		"chat_id":                  t.opts.ChatID,
+		"text":                     e.Text(),
+		"disable_web_page_preview": true,
+	})
+	if err != nil {
+		// The error contains the URL and with it the bot token.
+		if uerr, ok := err.(interface{ Unwrap() error }); ok {
+			err = uerr.Unwrap()
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	var r struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return fmt.Errorf("HTTP %d: invalid response: %v", resp.StatusCode, err)
+	}
+	if !r.OK {
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, r.Description)
+	}
+	return nil
+}
+
+type smtpNotifier struct {
+	opts SMTPOptions
+}
+
+func newSMTP(opts SMTPOptions) *smtpNotifier {
+	if opts.Port == 0 {
+		opts.Port = DefaultOptions().SMTP.Port
+	}
+	if opts.From == "" {
+		opts.From = opts.Username
+	}
+	return &smtpNotifier{opts: opts}
+}
+
+func (s *smtpNotifier) Name() string { return "smtp" }
+
+func (s *smtpNotifier) message(e *Event) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", s.opts.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(s.opts.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", e.Subject())
+	fmt.Fprintf(&b, "Date: %s\r\n", e.Time.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(e.Text(), "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// Send delivers the mail with STARTTLS when the server offers it, or over
+// implicit TLS on port 465.
+func (s *smtpNotifier) Send(ctx context.Context, e *Event) error {
+	addr := net.JoinHostPort(s.opts.Host, strconv.Itoa(s.opts.Port))
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	tlsConfig := &tls.Config{ServerName: s.opts.Host}
+	if s.opts.Port == 465 {
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	c, err := smtp.NewClient(conn, s.opts.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok && s.opts.Port != 465 {
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if s.opts.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.opts.Username, s.opts.Password, s.opts.Host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(s.opts.From); err != nil {
+		return err
+	}
+	for _, to := range s.opts.To {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(s.message(e)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
@@ -0,0 +1,250 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testEvent() *Event {
+	return &Event{
+		Kind:  KindScanComplete,
+		Time:  time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		Mode:  "normal",
+		Found: 2,
+		Top: []IP{
+			{IP: "1.1.1.1", DelayMs: 80, DownloadMBps: 2.5, Score: 90},
+			{IP: "2.2.2.2", DelayMs: 120, DownloadMBps: 1.25, Score: 70},
+		},
+	}
+}
+
+func TestWebhookSend(t *testing.T) {
+	var got Event
+	var header string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("request %s with content type %q", r.Method, r.Header.Get("Content-Type"))
+		}
+		header = r.Header.Get("X-Token")
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("invalid body: %v", err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	w := newWebhook(WebhookOptions{URL: srv.URL, Headers: map[string]string{"X-Token": "secret"}})
+	if err := w.Send(context.Background(), testEvent()); err != nil {
+		t.Fatal(err)
+	}
+	if header != "secret" {
+		t.Errorf("X-Token = %q", header)
+	}
+	if got.Kind != KindScanComplete || got.Found != 2 || len(got.Top) != 2 || got.Top[0].IP != "1.1.1.1" {
+		t.Errorf("payload = %+v", got)
+	}
+}
+
+func TestWebhookHTTPError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	err := newWebhook(WebhookOptions{URL: srv.URL}).Send(context.Background(), testEvent())
+	if err == nil || err.Error() != "HTTP 502" {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestTelegramSend(t *testing.T) {
+	var path string
+	var body map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		json.NewDecoder(r.Body).Decode(&body)
+		fmt.Fprint(w, `{"ok":true,"result":{}}`)
+	}))
+	defer srv.Close()
+
+	tg := newTelegram(TelegramOptions{BotToken: "123:abc", ChatID: "-100", BaseURL: srv.URL + "/"})
+	if err := tg.Send(context.Background(), testEvent()); err != nil {
+		t.Fatal(err)
+	}
+	if path != "/bot123:abc/sendMessage" {
+		t.Errorf("path = %q", path)
+	}
+	if body["chat_id"] != "-100" || body["text"] != testEvent().Text() {
+		t.Errorf("body = %v", body)
+	}
+}
+
+func TestTelegramError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"ok":false,"description":"Bad Request: chat not found"}`)
+	}))
+	defer srv.Close()
+
+	tg := newTelegram(TelegramOptions{BotToken: "123:abc", ChatID: "-100", BaseURL: srv.URL})
+	err := tg.Send(context.Background(), testEvent())
+	if err == nil || err.Error() != "HTTP 400: Bad Request: chat not found" {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestTelegramErrorHidesToken(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	tg := newTelegram(TelegramOptions{BotToken: "123:abc", ChatID: "-100", BaseURL: srv.URL})
+	err := tg.Send(context.Background(), testEvent())
+	if err == nil || strings.Contains(err.Error(), "123:abc") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+// fakeSMTP accepts one plain-text session, with AUTH PLAIN but without
+// STARTTLS, and records what the client sent.
+type fakeSMTP struct {
+	ln       net.Listener
+	auth     string
+	from     string
+	rcpt     []string
+	data     string
+	done     chan struct{}
+	rejectTo string
+}
+
+func newFakeSMTP(t *testing.T, rejectTo string) *fakeSMTP {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	s := &fakeSMTP{ln: ln, done: make(chan struct{}), rejectTo: rejectTo}
+	go s.serve()
+	return s
+}
+
+func (s *fakeSMTP) port() int {
+	return s.ln.Addr().(*net.TCPAddr).Port
+}
+
+func (s *fakeSMTP) serve() {
+	defer close(s.done)
+	conn, err := s.ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+
+	reply("220 fake ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch {
+		case cmd == "EHLO":
+			reply("250-fake")
+			reply("250 AUTH PLAIN")
+		case cmd == "AUTH":
+			s.auth = line
+			reply("235 accepted")
+		case strings.HasPrefix(strings.ToUpper(line), "MAIL FROM:"):
+			s.from = line[len("MAIL FROM:"):]
+			reply("250 ok")
+		case strings.HasPrefix(strings.ToUpper(line), "RCPT TO:"):
+			to := line[len("RCPT TO:"):]
+			if to == "<"+s.rejectTo+">" {
+				reply("550 no such user")
+				continue
+			}
+			s.rcpt = append(s.rcpt, to)
+			reply("250 ok")
+		case cmd == "DATA":
+			reply("354 go ahead")
+			var b strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				b.WriteString(l)
+			}
+			s.data = b.String()
+			reply("250 queued")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 unknown command")
+		}
+	}
+}
+
+func TestSMTPSend(t *testing.T) {
+	srv := newFakeSMTP(t, "")
+	n := newSMTP(SMTPOptions{
+		Host:     "127.0.0.1",
+		Port:     srv.port(),
+		Username: "scanner@example.com",
+		Password: "pw",
+		To:       []string{"a@example.com", "b@example.com"},
+	})
+	if err := n.Send(context.Background(), testEvent()); err != nil {
+		t.Fatal(err)
+	}
+	<-srv.done
+
+	wantAuth := "AUTH PLAIN " + base64.StdEncoding.EncodeToString([]byte("\x00scanner@example.com\x00pw"))
+	if srv.auth != wantAuth {
+		t.Errorf("auth = %q, want %q", srv.auth, wantAuth)
+	}
+	if srv.from != "<scanner@example.com>" {
+		t.Errorf("from = %q", srv.from)
+	}
+	if strings.Join(srv.rcpt, ",") != "<a@example.com>,<b@example.com>" {
+		t.Errorf("rcpt = %v", srv.rcpt)
+	}
+	for _, want := range []string{
+		"From: scanner@example.com\r\n",
+		"To: a@example.com, b@example.com\r\n",
+		"Subject: CF Clean IP Scanner: 2 clean IPs found\r\n",
+		"Content-Type: text/plain; charset=utf-8\r\n\r\n",
+		"1. 1.1.1.1  80ms  2.50 MB/s  score 90.0\r\n",
+	} {
+		if !strings.Contains(srv.data, want) {
+			t.Errorf("message does not contain %q:\n%s", want, srv.data)
+		}
+	}
+}
+
+func TestSMTPRecipientRejected(t *testing.T) {
+	srv := newFakeSMTP(t, "b@example.com")
+	n := newSMTP(SMTPOptions{Host: "127.0.0.1", Port: srv.port(), From: "scanner@example.com", To: []string{"a@example.com", "b@example.com"}})
+
+	err := n.Send(context.Background(), testEvent())
+	if err == nil || !strings.Contains(err.Error(), "550") {
+		t.Errorf("err = %v", err)
+	}
+}
\ No newline at end of file
@@ -0,0 +1,343 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/scanner"
+)
+
+type WebhookOptions struct {
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+}
+
+type TelegramOptions struct {
+	BotToken string `json:"bot_token"`
+	ChatID   string `json:"chat_id"`
+	BaseURL  string `json:"base_url"`
+}
+
+type SMTPOptions struct {
+	Host     string   `json:"host"`
+	Port     int      `json:"port"`
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+}
+
+type Options struct {
+	OnScanComplete   bool            `json:"on_scan_complete"`
+	PoolLowThreshold int             `json:"pool_low_threshold"`
+	TopN             int             `json:"top_n"`
+	StateFile        string          `json:"state_file"`
+	TimeoutSec       int             `json:"timeout_sec"`
+	Webhook          WebhookOptions  `json:"webhook"`
+	Telegram         TelegramOptions `json:"telegram"`
+	SMTP             SMTPOptions     `json:"smtp"`
+}
+
+func DefaultOptions() Options {
+	return Options{
+		OnScanComplete: true,
+		TopN:           5,
+		StateFile:      "last_notified.json",
+		TimeoutSec:     15,
+		Telegram: TelegramOptions{
+			BaseURL: "https://api.telegram.org",
+		},
+		SMTP: SMTPOptions{
+			Port: 587,
+		},
+	}
+}
+
+const (
+	KindScanComplete = "scan_complete"
+	KindPoolLow      = "pool_low"
+)
+
+type IP struct {
+	IP           string  `json:"ip"`
+	DelayMs      int     `json:"delay_ms"`
+	JitterMs     int     `json:"jitter_ms"`
+	LossRate     float32 `json:"loss_rate"`
+	DownloadMBps float64 `json:"download_mbps"`
+	Score        float64 `json:"score"`
+}
+
+// Diff compares the IPs of this notification with the previous one.
+type Diff struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+	Kept    []string `json:"kept"`
+}
+
+// Event is the payload handed to every notifier. Webhooks receive it as
+// JSON, chat and email notifiers receive Text.
+type Event struct {
+	Kind      string    `json:"event"`
+	Time      time.Time `json:"time"`
+	Mode      string    `json:"mode,omitempty"`
+	Elapsed   string    `json:"elapsed,omitempty"`
+	Found     int       `json:"found"`
+	Top       []IP      `json:"top"`
+	Diff      *Diff     `json:"diff,omitempty"`
+	Threshold int       `json:"threshold,omitempty"`
+}
+
+func (e *Event) Subject() string {
+	if e.Kind == KindPoolLow {
+		return fmt.Sprintf("CF Clean IP Scanner: pool low (%d/%d)", e.Found, e.Threshold)
+	}
+	return fmt.Sprintf("CF Clean IP Scanner: %d clean IPs found", e.Found)
+}
+
+func (e *Event) Text() string {
+	var b strings.Builder
+	b.WriteString(e.Subject())
+	b.WriteString("\n")
+	if e.Elapsed != "" {
+		fmt.Fprintf(&b, "Mode: %s, duration: %s\n", e.Mode, e.Elapsed)
+	}
+	if len(e.Top) > 0 {
+		b.WriteString("\nTop IPs:\n")
+		for i, ip := range e.Top {
+			fmt.Fprintf(&b, "%d. %s  %dms  %.2f MB/s  score %.1f\n", i+1, ip.IP, ip.DelayMs, ip.DownloadMBps, ip.Score)
+		}
+	}
+	if e.Diff != nil {
+		if len(e.Diff.Added) > 0 {
+			fmt.Fprintf(&b, "\nNew: %s\n", strings.Join(e.Diff.Added, ", "))
+		}
+		if len(e.Diff.Removed) > 0 {
+			fmt.Fprintf(&b, "Gone: %s\n", strings.Join(e.Diff.Removed, ", "))
+		}
+		if len(e.Diff.Added) == 0 && len(e.Diff.Removed) == 0 {
+			b.WriteString("\nNo change since the previous run.\n")
+		}
+	}
+	return b.String()
+}
+
+// Notifier delivers an event to one channel.
+type Notifier interface {
+	Name() string
+	Send(ctx context.Context, e *Event) error
+}
+
+// Manager sends events to every configured notifier and remembers, per
+// notifier, the results it last delivered so each notification can
+// include a diff.
+type Manager struct {
+	opts      Options
+	notifiers []Notifier
+
+	mu      sync.Mutex
+	poolLow map[string]bool
+}
+
+func New(opts Options) *Manager {
+	if opts.TimeoutSec <= 0 {
+		opts.TimeoutSec = DefaultOptions().TimeoutSec
+	}
+	m := &Manager{opts: opts, poolLow: make(map[string]bool)}
+	if opts.Webhook.URL != "" {
+		m.notifiers = append(m.notifiers, newWebhook(opts.Webhook))
+	}
+	if opts.Telegram.BotToken != "" && opts.Telegram.ChatID != "" {
+		m.notifiers = append(m.notifiers, newTelegram(opts.Telegram))
+	}
+	if opts.SMTP.Host != "" && len(opts.SMTP.To) > 0 {
+		m.notifiers = append(m.notifiers, newSMTP(opts.SMTP))
+	}
+	return m
+}
+
+// Enabled reports whether at least one notifier is configured.
+func (m *Manager) Enabled() bool {
+	return len(m.notifiers) > 0
+}
+
+func (m *Manager) topIPs(results []scanner.IPResult) []IP {
+	n := m.opts.TopN
+	if n <= 0 || n > len(results) {
+		n = len(results)
+	}
+	top := make([]IP, n)
+	for i, r := range results[:n] {
+		top[i] = IP{
+			IP:           r.IP.String(),
+			DelayMs:      r.Delay,
+			JitterMs:     r.Jitter,
+			LossRate:     r.LossRate,
+			DownloadMBps: r.DownloadSpeed / 1024 / 1024,
+			Score:        r.Score,
+		}
+	}
+	return top
+}
+
+// loadState returns the IPs of the last notification each notifier
+// delivered.
+func (m *Manager) loadState() map[string][]string {
+	states := make(map[string][]string)
+	if m.opts.StateFile == "" {
+		return states
+	}
+	data, err := os.ReadFile(m.opts.StateFile)
+	if err != nil {
+		return states
+	}
+	if json.Unmarshal(data, &states) == nil {
+		return states
+	}
+	// Older state files hold a single list for all notifiers.
+	states = make(map[string][]string)
+	var previous []string
+	if json.Unmarshal(data, &previous) == nil {
+		for _, n := range m.notifiers {
+			states[n.Name()] = previous
+		}
+	}
+	return states
+}
+
+func (m *Manager) saveState(states map[string][]string) {
+	if m.opts.StateFile == "" {
+		return
+	}
+	if data, err := json.Marshal(states); err == nil {
+		os.WriteFile(m.opts.StateFile, data, 0644)
+	}
+}
+
+func ipList(top []IP) []string {
+	ips := make([]string, len(top))
+	for i, ip := range top {
+		ips[i] = ip.IP
+	}
+	return ips
+}
+
+// diff compares top with previous, the IPs of the last notification that
+// was delivered.
+func diff(previous []string, top []IP) *Diff {
+	was := make(map[string]bool, len(previous))
+	for _, ip := range previous {
+		was[ip] = true
+	}
+	is := make(map[string]bool, len(top))
+	d := &Diff{}
+	for _, ip := range ipList(top) {
+		is[ip] = true
+		if was[ip] {
+			d.Kept = append(d.Kept, ip)
+		} else {
+			d.Added = append(d.Added, ip)
+		}
+	}
+	for _, ip := range previous {
+		if !is[ip] {
+			d.Removed = append(d.Removed, ip)
+		}
+	}
+	sort.Strings(d.Removed)
+	return d
+}
+
+// ScanComplete notifies about a finished scan. Each notifier gets the diff
+// against what it delivered last, and its state only moves on once it has
+// delivered this event, so a failed notification is not left out of its
+// next diff.
+func (m *Manager) ScanComplete(mode string, elapsed time.Duration, results []scanner.IPResult) error {
+	if !m.Enabled() || !m.opts.OnScanComplete {
+		return nil
+	}
+	top := m.topIPs(results)
+	event := Event{
+		Kind:    KindScanComplete,
+		Time:    time.Now(),
+		Mode:    mode,
+		Elapsed: elapsed.Truncate(time.Second).String(),
+		Found:   len(results),
+		Top:     top,
+	}
+
+	states := m.loadState()
+	err := m.send(m.notifiers, func(n Notifier) *Event {
+		e := event
+		if previous, ok := states[n.Name()]; ok {
+			e.Diff = diff(previous, top)
+		}
+		return &e
+	}, func(n Notifier) {
+		states[n.Name()] = ipList(top)
+	})
+	m.saveState(states)
+	return err
+}
+
+// PoolUpdated notifies once when the pool drops below the threshold and
+// again only after it has recovered and dropped again. A notifier that
+// failed to deliver the alert is tried again on the next update.
+func (m *Manager) PoolUpdated(pool []scanner.IPResult) error {
+	if !m.Enabled() || m.opts.PoolLowThreshold <= 0 {
+		return nil
+	}
+	low := len(pool) < m.opts.PoolLowThreshold
+	var pending []Notifier
+	m.mu.Lock()
+	for _, n := range m.notifiers {
+		if !low {
+			m.poolLow[n.Name()] = false
+		} else if !m.poolLow[n.Name()] {
+			pending = append(pending, n)
+		}
+	}
+	m.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	e := &Event{
+		Kind:      KindPoolLow,
+		Time:      time.Now(),
+		Found:     len(pool),
+		Top:       m.topIPs(pool),
+		Threshold: m.opts.PoolLowThreshold,
+	}
+	return m.send(pending, func(Notifier) *Event { return e }, func(n Notifier) {
+		m.mu.Lock()
+		m.poolLow[n.Name()] = true
+		m.mu.Unlock()
+	})
+}
+
+// send hands the event built by event to each of notifiers and calls
+// delivered for every one that took it. The error lists the others.
+func (m *Manager) send(notifiers []Notifier, event func(Notifier) *Event, delivered func(Notifier)) error {
+	timeout := time.Duration(m.opts.TimeoutSec) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var failed []string
+	for _, n := range notifiers {
+		if err := n.Send(ctx, event(n)); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", n.Name(), err))
+			continue
+		}
+		delivered(n)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%s", strings.Join(failed, "; "))
+	}
+	return nil
+}
\ No newline at end of file
@@ -0,0 +1,191 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/scanner"
+)
+
+func results(ips ...string) []scanner.IPResult {
+	out := make([]scanner.IPResult, len(ips))
+	for i, ip := range ips {
+		out[i] = scanner.IPResult{IP: &net.IPAddr{IP: net.ParseIP(ip)}, Delay: 100, DownloadSpeed: 1024 * 1024}
+	}
+	return out
+}
+
+func TestScanCompleteDiffAndState(t *testing.T) {
+	fail := false
+	var events []Event
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var e Event
+		json.NewDecoder(r.Body).Decode(&e)
+		events = append(events, e)
+	}))
+	defer srv.Close()
+
+	state := filepath.Join(t.TempDir(), "last_notified.json")
+	opts := DefaultOptions()
+	opts.StateFile = state
+	opts.Webhook.URL = srv.URL
+	m := New(opts)
+
+	if err := m.ScanComplete("normal", time.Minute, results("1.1.1.1", "2.2.2.2")); err != nil {
+		t.Fatal(err)
+	}
+	if events[0].Diff != nil {
+		t.Errorf("first notification has a diff: %+v", events[0].Diff)
+	}
+
+	// A failed delivery must not move the state on.
+	fail = true
+	if err := m.ScanComplete("normal", time.Minute, results("3.3.3.3")); err == nil {
+		t.Fatal("expected an error from the failing webhook")
+	}
+	data, _ := os.ReadFile(state)
+	if string(data) != `{"webhook":["1.1.1.1","2.2.2.2"]}` {
+		t.Errorf("state after failed send = %s", data)
+	}
+
+	fail = false
+	if err := m.ScanComplete("normal", time.Minute, results("2.2.2.2", "3.3.3.3")); err != nil {
+		t.Fatal(err)
+	}
+	d := events[1].Diff
+	if d == nil || len(d.Added) != 1 || d.Added[0] != "3.3.3.3" || len(d.Removed) != 1 || d.Removed[0] != "1.1.1.1" ||
+		len(d.Kept) != 1 || d.Kept[0] != "2.2.2.2" {
+		t.Errorf("diff = %+v", d)
+	}
+	data, _ = os.ReadFile(state)
+	if string(data) != `{"webhook":["2.2.2.2","3.3.3.3"]}` {
+		t.Errorf("state = %s", data)
+	}
+}
+
+func TestPoolUpdatedFiresOnce(t *testing.T) {
+	count := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count++
+	}))
+	defer srv.Close()
+
+	opts := DefaultOptions()
+	opts.StateFile = ""
+	opts.PoolLowThreshold = 2
+	opts.Webhook.URL = srv.URL
+	m := New(opts)
+
+	for _, pool := range [][]scanner.IPResult{
+		results("1.1.1.1"),
+		results(),
+		results("1.1.1.1", "2.2.2.2"),
+		results("1.1.1.1"),
+	} {
+		if err := m.PoolUpdated(pool); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if count != 2 {
+		t.Errorf("sent %d notifications, want 2", count)
+	}
+}
+
+// fakeNotifier records the events it gets and fails while fail is set.
+type fakeNotifier struct {
+	name   string
+	fail   bool
+	events []*Event
+}
+
+func (f *fakeNotifier) Name() string { return f.name }
+
+func (f *fakeNotifier) Send(ctx context.Context, e *Event) error {
+	if f.fail {
+		return errors.New("down")
+	}
+	f.events = append(f.events, e)
+	return nil
+}
+
+func newFakeManager(opts Options, notifiers ...*fakeNotifier) *Manager {
+	m := New(opts)
+	for _, n := range notifiers {
+		m.notifiers = append(m.notifiers, n)
+	}
+	return m
+}
+
+func TestScanCompleteStatePerNotifier(t *testing.T) {
+	state := filepath.Join(t.TempDir(), "last_notified.json")
+	// A state file from before the state was kept per notifier.
+	os.WriteFile(state, []byte(`["1.1.1.1"]`), 0644)
+	opts := DefaultOptions()
+	opts.StateFile = state
+	a, b := &fakeNotifier{name: "a"}, &fakeNotifier{name: "b", fail: true}
+	m := newFakeManager(opts, a, b)
+
+	if err := m.ScanComplete("normal", time.Minute, results("2.2.2.2")); err == nil {
+		t.Fatal("expected the error of b")
+	}
+	if d := a.events[0].Diff; d == nil || len(d.Added) != 1 || len(d.Removed) != 1 {
+		t.Errorf("diff of a = %+v", d)
+	}
+
+	b.fail = false
+	if err := m.ScanComplete("normal", time.Minute, results("2.2.2.2")); err != nil {
+		t.Fatal(err)
+	}
+	// a already reported 2.2.2.2; b still compares with what it last
+	// delivered.
+	if d := a.events[1].Diff; d == nil || len(d.Added) != 0 || len(d.Removed) != 0 {
+		t.Errorf("second diff of a = %+v", d)
+	}
+	if d := b.events[0].Diff; d == nil || len(d.Added) != 1 || d.Added[0] != "2.2.2.2" || len(d.Removed) != 1 || d.Removed[0] != "1.1.1.1" {
+		t.Errorf("diff of b = %+v", d)
+	}
+}
+
+func TestPoolUpdatedRetriesFailedNotifier(t *testing.T) {
+	opts := DefaultOptions()
+	opts.StateFile = ""
+	opts.PoolLowThreshold = 2
+	a, b := &fakeNotifier{name: "a"}, &fakeNotifier{name: "b", fail: true}
+	m := newFakeManager(opts, a, b)
+
+	if err := m.PoolUpdated(results("1.1.1.1")); err == nil {
+		t.Fatal("expected the error of b")
+	}
+	b.fail = false
+	if err := m.PoolUpdated(results("1.1.1.1")); err != nil {
+		t.Fatal(err)
+	}
+	if len(a.events) != 1 || len(b.events) != 1 {
+		t.Errorf("a got %d alerts and b %d, want one each", len(a.events), len(b.events))
+	}
+}
+
+func TestSendWithoutTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	opts := DefaultOptions()
+	opts.StateFile = ""
+	opts.TimeoutSec = 0
+	opts.Webhook.URL = srv.URL
+	if err := New(opts).ScanComplete("normal", time.Minute, results("1.1.1.1")); err != nil {
+		t.Errorf("send with timeout_sec 0: %v", err)
+	}
+}
\ No newline at end of file
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/config"
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/publish"
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/scanner"
+)
+
+func newPublisher(settings *config.Settings) *publish.Publisher {
+	p, err := publish.New(settings.Publish)
+	if err != nil {
+		color.New(color.FgRed).Printf("Cannot publish DNS records: %v\n", err)
+		return nil
+	}
+	return p
+}
+
+func publishResults(p *publish.Publisher, settings *config.Settings, results []scanner.IPResult) {
+	if p == nil || len(results) == 0 {
+		return
+	}
+	change, err := p.Publish(results)
+	if err != nil {
+		color.New(color.FgRed).Printf("Error publishing DNS records: %v\n", err)
+		return
+	}
+
+	host := settings.Publish.Hostname
+	switch {
+	case settings.Publish.DryRun:
+		color.New(color.FgYellow).Printf("DNS dry run for %s: add [%s], remove [%s], keep [%s]\n", host,
+			strings.Join(change.Added, ", "), strings.Join(change.Removed, ", "), strings.Join(change.Kept, ", "))
+	case !change.Applied:
+		color.New(color.FgCyan).Printf("DNS records of %s already up to date\n", host)
+	default:
+		color.New(color.FgGreen).Printf("DNS records of %s updated: added [%s], removed [%s]\n", host,
+			strings.Join(change.Added, ", "), strings.Join(change.Removed, ", "))
+	}
+}
\ No newline at end of file
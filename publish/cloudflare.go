@@ -0,0 +1,182 @@
+package publish
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// cloudflare talks to the Cloudflare v4 DNS records API. BaseURL can point
+// at a local stand-in for testing.
+type cloudflare struct {
+	opts   CloudflareOptions
+	client *http.Client
+	zoneID string
+}
+
+type cfRecord struct {
+	ID      string `json:"id,omitempty"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	TTL     int    `json:"ttl"`
+	Proxied bool   `json:"proxied"`
+}
+
+type cfResponse struct {
+	Success bool `json:"success"`
+	Errors  []struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+	Result json.RawMessage `json:"result"`
+}
+
+func newCloudflare(opts CloudflareOptions) *cloudflare {
+	if opts.BaseURL == "" {
+		opts.BaseURL = DefaultOptions().Cloudflare.BaseURL
+	}
+	opts.BaseURL = strings.TrimRight(opts.BaseURL, "/")
+	return &cloudflare{opts: opts, client: &http.Client{}, zoneID: opts.ZoneID}
+}
+
+func (c *cloudflare) do(ctx context.Context, method, path string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.opts.BaseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.opts.APIToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var r cfResponse
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return fmt.Errorf("%s %s: HTTP %d: invalid response: %v", method, path, resp.StatusCode, err)
+	}
+	if !r.Success {
+		msgs := make([]string, 0, len(r.Errors))
+		for _, e := range r.Errors {
+			msgs = append(msgs, fmt.Sprintf("%d %s", e.Code, e.Message))
+		}
+		return fmt.Errorf("%s %s: HTTP %d: %s", method, path, resp.StatusCode, strings.Join(msgs, "; "))
+	}
+	if out != nil {
+		return json.Unmarshal(r.Result, out)
+	}
+	return nil
+}
+
+// zone returns the zone ID, looking it up from the hostname's parent
+// domains when it is not configured.
+func (c *cloudflare) zone(ctx context.Context, name string) (string, error) {
+	if c.zoneID != "" {
+		return c.zoneID, nil
+	}
+	labels := strings.Split(strings.TrimSuffix(name, "."), ".")
+	for i := 0; i < len(labels)-1; i++ {
+		var zones []struct {
+			ID string `json:"id"`
+		}
+		candidate := strings.Join(labels[i:], ".")
+		if err := c.do(ctx, http.MethodGet, "/zones?name="+url.QueryEscape(candidate), nil, &zones); err != nil {
+			return "", err
+		}
+		if len(zones) > 0 {
+			c.zoneID = zones[0].ID
+			return c.zoneID, nil
+		}
+	}
+	return "", fmt.Errorf("no Cloudflare zone found for %s", name)
+}
+
+func (c *cloudflare) list(ctx context.Context, zone, name string) ([]cfRecord, error) {
+	var all []cfRecord
+	for _, typ := range []string{"A", "AAAA"} {
+		var records []cfRecord
+		q := url.Values{"type": {typ}, "name": {name}}
+		if err := c.do(ctx, http.MethodGet, "/zones/"+zone+"/dns_records?"+q.Encode(), nil, &records); err != nil {
+			return nil, err
+		}
+		all = append(all, records...)
+	}
+	return all, nil
+}
+
+func (c *cloudflare) Records(ctx context.Context, name string) ([]Record, error) {
+	zone, err := c.zone(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	records, err := c.list(ctx, zone, name)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Record, len(records))
+	for i, r := range records {
+		out[i] = Record{IP: r.Content, TTL: r.TTL}
+	}
+	return out, nil
+}
+
+// Replace creates the missing records first and removes stale ones last,
+// so the hostname never resolves to nothing while it is being updated.
+func (c *cloudflare) Replace(ctx context.Context, name string, ips []string, ttl int) error {
+	zone, err := c.zone(ctx, name)
+	if err != nil {
+		return err
+	}
+	existing, err := c.list(ctx, zone, name)
+	if err != nil {
+		return err
+	}
+
+	wanted := make(map[string]bool, len(ips))
+	for _, ip := range ips {
+		wanted[normalizeIP(ip)] = true
+	}
+	have := make(map[string]bool, len(existing))
+	for _, r := range existing {
+		have[normalizeIP(r.Content)] = true
+	}
+
+	for _, ip := range ips {
+		if have[normalizeIP(ip)] {
+			continue
+		}
+		rec := cfRecord{Type: recordType(ip), Name: name, Content: ip, TTL: ttl}
+		if err := c.do(ctx, http.MethodPost, "/zones/"+zone+"/dns_records", rec, nil); err != nil {
+			return err
+		}
+	}
+	for _, r := range existing {
+		path := "/zones/" + zone + "/dns_records/" + r.ID
+		if !wanted[normalizeIP(r.Content)] {
+			if err := c.do(ctx, http.MethodDelete, path, nil, nil); err != nil {
+				return err
+			}
+		} else if r.TTL != ttl {
+			if err := c.do(ctx, http.MethodPatch, path, map[string]int{"ttl": ttl}, nil); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
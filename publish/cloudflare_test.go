@@ -0,0 +1,197 @@
+package publish
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeCloudflare is a stand-in for the DNS records API that keeps its
+// records in memory and logs every request.
+type fakeCloudflare struct {
+	mu      sync.Mutex
+	zones   map[string]string
+	records []cfRecord
+	nextID  int
+	log     []string
+}
+
+func (f *fakeCloudflare) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.log = append(f.log, r.Method+" "+r.URL.RequestURI())
+
+	if r.Header.Get("Authorization") != "Bearer token" {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"success":false,"errors":[{"code":9109,"message":"Invalid access token"}]}`)
+		return
+	}
+
+	reply := func(result interface{}) {
+		data, _ := json.Marshal(result)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "errors": []string{}, "result": json.RawMessage(data)})
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.URL.Path == "/zones":
+		zones := []map[string]string{}
+		if id, ok := f.zones[r.URL.Query().Get("name")]; ok {
+			zones = append(zones, map[string]string{"id": id})
+		}
+		reply(zones)
+	case len(parts) == 3 && r.Method == http.MethodGet:
+		var out []cfRecord
+		for _, rec := range f.records {
+			if rec.Type == r.URL.Query().Get("type") && rec.Name == r.URL.Query().Get("name") {
+				out = append(out, rec)
+			}
+		}
+		reply(out)
+	case len(parts) == 3 && r.Method == http.MethodPost:
+		var rec cfRecord
+		json.NewDecoder(r.Body).Decode(&rec)
+		f.nextID++
+		rec.ID = fmt.Sprintf("rec%d", f.nextID)
+		f.records = append(f.records, rec)
+		reply(rec)
+	case len(parts) == 4 && r.Method == http.MethodDelete:
+		for i, rec := range f.records {
+			if rec.ID == parts[3] {
+				f.records = append(f.records[:i], f.records[i+1:]...)
+				reply(map[string]string{"id": rec.ID})
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"success":false,"errors":[{"code":81044,"message":"Record does not exist."}]}`)
+	case len(parts) == 4 && r.Method == http.MethodPatch:
+		var patch struct {
+			TTL int `json:"ttl"`
+		}
+		json.NewDecoder(r.Body).Decode(&patch)
+		for i := range f.records {
+			if f.records[i].ID == parts[3] {
+				f.records[i].TTL = patch.TTL
+				reply(f.records[i])
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, "not found")
+	}
+}
+
+func newFakeCloudflare(t *testing.T) (*fakeCloudflare, *cloudflare) {
+	f := &fakeCloudflare{
+		zones: map[string]string{"example.com": "zone1"},
+		records: []cfRecord{
+			{ID: "old1", Type: "A", Name: "cdn.example.com", Content: "1.1.1.1", TTL: 60},
+			{ID: "old2", Type: "A", Name: "cdn.example.com", Content: "2.2.2.2", TTL: 300},
+			{ID: "other", Type: "A", Name: "www.example.com", Content: "9.9.9.9", TTL: 60},
+		},
+	}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, newCloudflare(CloudflareOptions{APIToken: "token", BaseURL: srv.URL + "/"})
+}
+
+func TestCloudflareRecordsLooksUpZone(t *testing.T) {
+	f, c := newFakeCloudflare(t)
+
+	records, err := c.Records(context.Background(), "cdn.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0] != (Record{IP: "1.1.1.1", TTL: 60}) || records[1] != (Record{IP: "2.2.2.2", TTL: 300}) {
+		t.Errorf("records = %v", records)
+	}
+	want := []string{
+		"GET /zones?name=cdn.example.com",
+		"GET /zones?name=example.com",
+		"GET /zones/zone1/dns_records?name=cdn.example.com&type=A",
+		"GET /zones/zone1/dns_records?name=cdn.example.com&type=AAAA",
+	}
+	if strings.Join(f.log, "\n") != strings.Join(want, "\n") {
+		t.Errorf("requests:\n%s\nwant:\n%s", strings.Join(f.log, "\n"), strings.Join(want, "\n"))
+	}
+
+	// The zone ID is remembered.
+	f.log = nil
+	if _, err := c.Records(context.Background(), "cdn.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.log) != 2 {
+		t.Errorf("second lookup sent %v", f.log)
+	}
+}
+
+func TestCloudflareReplace(t *testing.T) {
+	f, c := newFakeCloudflare(t)
+	c.zoneID = "zone1"
+
+	if err := c.Replace(context.Background(), "cdn.example.com", []string{"2.2.2.2", "3.3.3.3", "2606:4700::1"}, 60); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"GET /zones/zone1/dns_records?name=cdn.example.com&type=A",
+		"GET /zones/zone1/dns_records?name=cdn.example.com&type=AAAA",
+		"POST /zones/zone1/dns_records",
+		"POST /zones/zone1/dns_records",
+		"DELETE /zones/zone1/dns_records/old1",
+		"PATCH /zones/zone1/dns_records/old2",
+	}
+	if strings.Join(f.log, "\n") != strings.Join(want, "\n") {
+		t.Errorf("requests:\n%s\nwant:\n%s", strings.Join(f.log, "\n"), strings.Join(want, "\n"))
+	}
+
+	got := map[string]cfRecord{}
+	for _, rec := range f.records {
+		if rec.Name == "cdn.example.com" {
+			got[rec.Content] = rec
+		}
+	}
+	if len(got) != 3 {
+		t.Fatalf("records after replace: %v", f.records)
+	}
+	for ip, typ := range map[string]string{"2.2.2.2": "A", "3.3.3.3": "A", "2606:4700::1": "AAAA"} {
+		if rec, ok := got[ip]; !ok || rec.Type != typ || rec.TTL != 60 {
+			t.Errorf("record %s = %+v, want type %s and TTL 60", ip, rec, typ)
+		}
+	}
+}
+
+func TestCloudflareErrorEnvelope(t *testing.T) {
+	_, c := newFakeCloudflare(t)
+	c.opts.APIToken = "wrong"
+
+	_, err := c.Records(context.Background(), "cdn.example.com")
+	if err == nil || !strings.Contains(err.Error(), "HTTP 403: 9109 Invalid access token") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestCloudflareInvalidResponse(t *testing.T) {
+	_, c := newFakeCloudflare(t)
+	c.zoneID = "zone1"
+
+	err := c.do(context.Background(), http.MethodGet, "/missing", nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "HTTP 404: invalid response") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestCloudflareNoZone(t *testing.T) {
+	_, c := newFakeCloudflare(t)
+
+	_, err := c.Records(context.Background(), "cdn.example.org")
+	if err == nil || !strings.Contains(err.Error(), "no Cloudflare zone found") {
+		t.Errorf("err = %v", err)
+	}
+}
\ No newline at end of file
@@ -0,0 +1,200 @@
+package publish
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/scanner"
+)
+
+type CloudflareOptions struct {
+	APIToken string `json:"api_token"`
+	ZoneID   string `json:"zone_id"`
+	BaseURL  string `json:"base_url"`
+}
+
+type RFC2136Options struct {
+	Server        string `json:"server"`
+	Zone          string `json:"zone"`
+	TSIGName      string `json:"tsig_name"`
+	TSIGSecret    string `json:"tsig_secret"`
+	TSIGAlgorithm string `json:"tsig_algorithm"`
+}
+
+type Options struct {
+	Enabled      bool              `json:"enabled"`
+	Provider     string            `json:"provider"`
+	Hostname     string            `json:"hostname"`
+	Count        int               `json:"count"`
+	TTL          int               `json:"ttl"`
+	DryRun       bool              `json:"dry_run"`
+	OnlyOnChange bool              `json:"only_on_change"`
+	TimeoutSec   int               `json:"timeout_sec"`
+	Cloudflare   CloudflareOptions `json:"cloudflare"`
+	RFC2136      RFC2136Options    `json:"rfc2136"`
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Provider:     "cloudflare",
+		Count:        2,
+		TTL:          60,
+		OnlyOnChange: true,
+		TimeoutSec:   15,
+		Cloudflare: CloudflareOptions{
+			BaseURL: "https://api.cloudflare.com/client/v4",
+		},
+		RFC2136: RFC2136Options{
+			TSIGAlgorithm: "hmac-sha256",
+		},
+	}
+}
+
+// Record is a single A or AAAA record of the published hostname.
+type Record struct {
+	IP  string
+	TTL int
+}
+
+// Backend reads and replaces the address records of one hostname.
+type Backend interface {
+	Records(ctx context.Context, name string) ([]Record, error)
+	Replace(ctx context.Context, name string, ips []string, ttl int) error
+}
+
+// Change describes the difference between the published and wanted IPs.
+type Change struct {
+	Hostname string
+	Added    []string
+	Removed  []string
+	Kept     []string
+	Applied  bool
+}
+
+func (c *Change) Empty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0
+}
+
+type Publisher struct {
+	opts    Options
+	backend Backend
+}
+
+func New(opts Options) (*Publisher, error) {
+	if opts.Hostname == "" {
+		return nil, fmt.Errorf("no hostname configured for publishing")
+	}
+	if opts.TimeoutSec <= 0 {
+		opts.TimeoutSec = DefaultOptions().TimeoutSec
+	}
+	var backend Backend
+	switch strings.ToLower(opts.Provider) {
+	case "cloudflare", "":
+		if opts.Cloudflare.APIToken == "" {
+			return nil, fmt.Errorf("cloudflare provider needs an api_token")
+		}
+		backend = newCloudflare(opts.Cloudflare)
+	case "rfc2136":
+		if opts.RFC2136.Server == "" {
+			return nil, fmt.Errorf("rfc2136 provider needs a server")
+		}
+		b, err := newRFC2136(opts.RFC2136)
+		if err != nil {
+			return nil, err
+		}
+		backend = b
+	default:
+		return nil, fmt.Errorf("unknown DNS provider: %s", opts.Provider)
+	}
+	return &Publisher{opts: opts, backend: backend}, nil
+}
+
+// Publish points the hostname at the first Count results. Unchanged
+// records are left alone when OnlyOnChange is set, and nothing is written
+// in dry-run mode.
+func (p *Publisher) Publish(results []scanner.IPResult) (*Change, error) {
+	n := p.opts.Count
+	if n <= 0 || n > len(results) {
+		n = len(results)
+	}
+	if n == 0 {
+		return nil, fmt.Errorf("no IPs to publish")
+	}
+	wanted := make([]string, n)
+	for i, r := range results[:n] {
+		wanted[i] = r.IP.String()
+	}
+
+	timeout := time.Duration(p.opts.TimeoutSec) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	current, err := p.backend.Records(ctx, p.opts.Hostname)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read current records: %v", err)
+	}
+
+	change := diff(p.opts.Hostname, current, wanted)
+	ttlChanged := false
+	for _, r := range current {
+		if r.TTL != p.opts.TTL {
+			ttlChanged = true
+		}
+	}
+	if p.opts.DryRun || (p.opts.OnlyOnChange && change.Empty() && !ttlChanged) {
+		return change, nil
+	}
+
+	if err := p.backend.Replace(ctx, p.opts.Hostname, wanted, p.opts.TTL); err != nil {
+		return change, fmt.Errorf("cannot update records: %v", err)
+	}
+	change.Applied = true
+	return change, nil
+}
+
+func diff(hostname string, current []Record, wanted []string) *Change {
+	have := make(map[string]bool, len(current))
+	for _, r := range current {
+		have[normalizeIP(r.IP)] = true
+	}
+	want := make(map[string]bool, len(wanted))
+	for _, ip := range wanted {
+		want[normalizeIP(ip)] = true
+	}
+
+	c := &Change{Hostname: hostname}
+	for ip := range want {
+		if have[ip] {
+			c.Kept = append(c.Kept, ip)
+		} else {
+			c.Added = append(c.Added, ip)
+		}
+	}
+	for ip := range have {
+		if !want[ip] {
+			c.Removed = append(c.Removed, ip)
+		}
+	}
+	sort.Strings(c.Added)
+	sort.Strings(c.Removed)
+	sort.Strings(c.Kept)
+	return c
+}
+
+func normalizeIP(s string) string {
+	if ip := net.ParseIP(s); ip != nil {
+		return ip.String()
+	}
+	return s
+}
+
+func recordType(ip string) string {
+	if parsed := net.ParseIP(ip); parsed != nil && parsed.To4() == nil {
+		return "AAAA"
+	}
+	return "A"
+}
\ No newline at end of file
@@ -0,0 +1,27 @@
+package publish
+
+import (
+	"net"
+	"testing"
+
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/scanner"
+)
+
+func TestPublishWithoutTimeout(t *testing.T) {
+	f, c := newFakeCloudflare(t)
+	p, err := New(Options{Hostname: "cdn.example.com", Count: 1, TTL: 60, Cloudflare: c.opts})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	change, err := p.Publish([]scanner.IPResult{{IP: &net.IPAddr{IP: net.ParseIP("3.3.3.3")}}})
+	if err != nil {
+		t.Fatalf("publish with timeout_sec 0: %v", err)
+	}
+	if !change.Applied || len(change.Added) != 1 || len(change.Removed) != 2 {
+		t.Errorf("change = %+v", change)
+	}
+	if len(f.records) != 2 {
+		t.Errorf("records = %v", f.records)
+	}
+}
\ No newline at end of file
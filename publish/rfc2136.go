@@ -0,0 +1,303 @@
+package publish
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	tsigType  = dnsmessage.Type(250)
+	tsigFudge = 300
+)
+
+var tsigAlgorithms = map[string]func() hash.Hash{
+	"hmac-md5":    md5.New,
+	"hmac-sha1":   sha1.New,
+	"hmac-sha256": sha256.New,
+	"hmac-sha512": sha512.New,
+}
+
+// rfc2136 sends dynamic updates over TCP, optionally signed with TSIG.
+type rfc2136 struct {
+	opts   RFC2136Options
+	zone   dnsmessage.Name
+	secret []byte
+	newMAC func() hash.Hash
+}
+
+func newRFC2136(opts RFC2136Options) (*rfc2136, error) {
+	if _, _, err := net.SplitHostPort(opts.Server); err != nil {
+		opts.Server = net.JoinHostPort(opts.Server, "53")
+	}
+	b := &rfc2136{opts: opts}
+	if opts.Zone != "" {
+		zone, err := dnsmessage.NewName(fqdn(opts.Zone))
+		if err != nil {
+			return nil, fmt.Errorf("invalid zone %q: %v", opts.Zone, err)
+		}
+		b.zone = zone
+	}
+	if opts.TSIGName != "" {
+		alg := strings.ToLower(strings.TrimSuffix(opts.TSIGAlgorithm, "."))
+		newMAC, ok := tsigAlgorithms[alg]
+		if !ok {
+			return nil, fmt.Errorf("unsupported TSIG algorithm: %s", opts.TSIGAlgorithm)
+		}
+		secret, err := base64.StdEncoding.DecodeString(opts.TSIGSecret)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TSIG secret: %v", err)
+		}
+		b.opts.TSIGAlgorithm = alg
+		b.secret = secret
+		b.newMAC = newMAC
+	}
+	return b, nil
+}
+
+func fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+// query asks the server for the records of name of type typ. A name that
+// does not exist is not an error.
+func (b *rfc2136) query(ctx context.Context, name dnsmessage.Name, typ dnsmessage.Type) (*dnsmessage.Message, error) {
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: uint16(rand.Intn(1 << 16))})
+	builder.StartQuestions()
+	builder.Question(dnsmessage.Question{Name: name, Type: typ, Class: dnsmessage.ClassINET})
+	query, err := builder.Finish()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := b.exchange(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if resp.RCode != dnsmessage.RCodeSuccess && resp.RCode != dnsmessage.RCodeNameError {
+		return nil, fmt.Errorf("query for %s failed: %v", name, resp.RCode)
+	}
+	return resp, nil
+}
+
+func (b *rfc2136) Records(ctx context.Context, name string) ([]Record, error) {
+	qname, err := dnsmessage.NewName(fqdn(name))
+	if err != nil {
+		return nil, err
+	}
+	var records []Record
+	for _, typ := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		resp, err := b.query(ctx, qname, typ)
+		if err != nil {
+			return nil, err
+		}
+		for _, ans := range resp.Answers {
+			switch body := ans.Body.(type) {
+			case *dnsmessage.AResource:
+				records = append(records, Record{IP: net.IP(body.A[:]).String(), TTL: int(ans.Header.TTL)})
+			case *dnsmessage.AAAAResource:
+				records = append(records, Record{IP: net.IP(body.AAAA[:]).String(), TTL: int(ans.Header.TTL)})
+			}
+		}
+	}
+	return records, nil
+}
+
+// findZone returns the configured zone or else asks the server for the
+// SOA of name. The SOA comes back as the answer when name is the apex of
+// its zone and in the authority section when it is below it.
+func (b *rfc2136) findZone(ctx context.Context, name dnsmessage.Name) (dnsmessage.Name, error) {
+	if b.zone.Length > 0 {
+		return b.zone, nil
+	}
+	resp, err := b.query(ctx, name, dnsmessage.TypeSOA)
+	if err != nil {
+		return dnsmessage.Name{}, err
+	}
+	for _, rr := range append(resp.Answers, resp.Authorities...) {
+		if _, ok := rr.Body.(*dnsmessage.SOAResource); ok {
+			b.zone = rr.Header.Name
+			return b.zone, nil
+		}
+	}
+	return dnsmessage.Name{}, fmt.Errorf("cannot find the zone of %s on %s, set the zone in the rfc2136 settings", name, b.opts.Server)
+}
+
+// Replace sends a single update that deletes the existing A and AAAA
+// RRsets of name and adds ips, so the change is applied atomically.
+func (b *rfc2136) Replace(ctx context.Context, name string, ips []string, ttl int) error {
+	owner, err := dnsmessage.NewName(fqdn(name))
+	if err != nil {
+		return err
+	}
+	zone, err := b.findZone(ctx, owner)
+	if err != nil {
+		return err
+	}
+
+	id := uint16(rand.Intn(1 << 16))
+	msg, err := b.buildUpdate(id, zone, owner, ips, ttl, nil)
+	if err != nil {
+		return err
+	}
+	if b.newMAC != nil {
+		tsig, err := b.sign(msg, id)
+		if err != nil {
+			return err
+		}
+		if msg, err = b.buildUpdate(id, zone, owner, ips, ttl, tsig); err != nil {
+			return err
+		}
+	}
+
+	resp, err := b.exchange(ctx, msg)
+	if err != nil {
+		return err
+	}
+	if resp.RCode != dnsmessage.RCodeSuccess {
+		return fmt.Errorf("update refused by %s: %v", b.opts.Server, resp.RCode)
+	}
+	return nil
+}
+
+func (b *rfc2136) buildUpdate(id uint16, zone, owner dnsmessage.Name, ips []string, ttl int, tsig *dnsmessage.UnknownResource) ([]byte, error) {
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, OpCode: 5})
+	builder.StartQuestions()
+	builder.Question(dnsmessage.Question{Name: zone, Type: dnsmessage.TypeSOA, Class: dnsmessage.ClassINET})
+	builder.StartAnswers()
+	builder.StartAuthorities()
+
+	// Class ANY with an empty body deletes the whole RRset.
+	for _, typ := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		h := dnsmessage.ResourceHeader{Name: owner, Class: dnsmessage.ClassANY}
+		if err := builder.UnknownResource(h, dnsmessage.UnknownResource{Type: typ}); err != nil {
+			return nil, err
+		}
+	}
+	for _, s := range ips {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP: %s", s)
+		}
+		h := dnsmessage.ResourceHeader{Name: owner, Class: dnsmessage.ClassINET, TTL: uint32(ttl)}
+		var err error
+		if ip4 := ip.To4(); ip4 != nil {
+			var a dnsmessage.AResource
+			copy(a.A[:], ip4)
+			err = builder.AResource(h, a)
+		} else {
+			var aaaa dnsmessage.AAAAResource
+			copy(aaaa.AAAA[:], ip.To16())
+			err = builder.AAAAResource(h, aaaa)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if tsig != nil {
+		builder.StartAdditionals()
+		keyName, _ := dnsmessage.NewName(fqdn(b.opts.TSIGName))
+		h := dnsmessage.ResourceHeader{Name: keyName, Class: dnsmessage.ClassANY}
+		if err := builder.UnknownResource(h, *tsig); err != nil {
+			return nil, err
+		}
+	}
+	return builder.Finish()
+}
+
+// sign computes the TSIG record for msg as described in RFC 8945.
+func (b *rfc2136) sign(msg []byte, id uint16) (*dnsmessage.UnknownResource, error) {
+	keyName := wireName(b.opts.TSIGName)
+	algName := wireName(b.opts.TSIGAlgorithm)
+	if b.opts.TSIGAlgorithm == "hmac-md5" {
+		algName = wireName("hmac-md5.sig-alg.reg.int")
+	}
+	now := uint64(time.Now().Unix())
+
+	timeSigned := make([]byte, 8)
+	binary.BigEndian.PutUint64(timeSigned, now)
+	timeSigned = timeSigned[2:]
+
+	mac := hmac.New(b.newMAC, b.secret)
+	mac.Write(msg)
+	mac.Write(keyName)
+	mac.Write([]byte{0, 255, 0, 0, 0, 0}) // class ANY, TTL 0
+	mac.Write(algName)
+	mac.Write(timeSigned)
+	mac.Write([]byte{tsigFudge >> 8, tsigFudge & 0xff, 0, 0, 0, 0}) // fudge, error, other len
+	sum := mac.Sum(nil)
+
+	var data []byte
+	data = append(data, algName...)
+	data = append(data, timeSigned...)
+	data = binary.BigEndian.AppendUint16(data, tsigFudge)
+	data = binary.BigEndian.AppendUint16(data, uint16(len(sum)))
+	data = append(data, sum...)
+	data = binary.BigEndian.AppendUint16(data, id)
+	data = append(data, 0, 0, 0, 0) // error, other len
+	return &dnsmessage.UnknownResource{Type: tsigType, Data: data}, nil
+}
+
+// wireName encodes name in uncompressed, lower-case wire format.
+func wireName(name string) []byte {
+	var out []byte
+	for _, label := range strings.Split(strings.TrimSuffix(strings.ToLower(name), "."), ".") {
+		if label == "" {
+			continue
+		}
+		out = append(out, byte(len(label)))
+		out = append(out, label...)
+	}
+	return append(out, 0)
+}
+
+func (b *rfc2136) exchange(ctx context.Context, msg []byte) (*dnsmessage.Message, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", b.opts.Server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	framed := binary.BigEndian.AppendUint16(nil, uint16(len(msg)))
+	if _, err := conn.Write(append(framed, msg...)); err != nil {
+		return nil, err
+	}
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return nil, err
+	}
+
+	var resp dnsmessage.Message
+	if err := resp.Unpack(buf); err != nil {
+		return nil, fmt.Errorf("invalid response from %s: %v", b.opts.Server, err)
+	}
+	if binary.BigEndian.Uint16(msg) != resp.ID {
+		return nil, fmt.Errorf("response ID mismatch from %s", b.opts.Server)
+	}
+	return &resp, nil
+}
\ No newline at end of file
@@ -0,0 +1,340 @@
+package publish
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+var testTSIGSecret = []byte("0123456789abcdef0123456789abcdef")
+
+// fakeDNS is a stand-in for a primary server that accepts dynamic updates
+// over TCP. It answers SOA, A and AAAA queries for one zone and keeps the
+// raw bytes of every update it receives.
+type fakeDNS struct {
+	t       *testing.T
+	ln      net.Listener
+	zone    string
+	rcode   dnsmessage.RCode
+	mu      sync.Mutex
+	updates [][]byte
+}
+
+func newFakeDNS(t *testing.T, zone string) *fakeDNS {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeDNS{t: t, ln: ln, zone: zone}
+	t.Cleanup(func() { ln.Close() })
+	go f.serve()
+	return f
+}
+
+func (f *fakeDNS) serve() {
+	for {
+		conn, err := f.ln.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeDNS) handle(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return
+	}
+	raw := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, raw); err != nil {
+		return
+	}
+	// Message.Unpack reads four bytes of data for every A record, so the
+	// empty delete records of an update are read with a Parser instead.
+	var p dnsmessage.Parser
+	h, err := p.Start(raw)
+	if err != nil {
+		f.t.Errorf("server could not parse request: %v", err)
+		return
+	}
+	resp := dnsmessage.Message{Header: dnsmessage.Header{ID: h.ID, Response: true, OpCode: h.OpCode}}
+	if h.OpCode == 5 {
+		f.mu.Lock()
+		f.updates = append(f.updates, raw)
+		resp.RCode = f.rcode
+		f.mu.Unlock()
+	} else {
+		q, err := p.Question()
+		if err != nil {
+			f.t.Errorf("server could not parse question: %v", err)
+			return
+		}
+		resp.Questions = []dnsmessage.Question{q}
+		resp.Answers, resp.Authorities = f.answer(q)
+	}
+	out, err := resp.Pack()
+	if err != nil {
+		f.t.Errorf("server could not pack response: %v", err)
+		return
+	}
+	conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(out))), out...))
+}
+
+func (f *fakeDNS) answer(q dnsmessage.Question) (answers, authorities []dnsmessage.Resource) {
+	zone := dnsmessage.MustNewName(f.zone)
+	soa := dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: zone, Type: dnsmessage.TypeSOA, Class: dnsmessage.ClassINET, TTL: 300},
+		Body: &dnsmessage.SOAResource{
+			NS:     dnsmessage.MustNewName("ns." + f.zone),
+			MBox:   dnsmessage.MustNewName("admin." + f.zone),
+			Serial: 1, Refresh: 3600, Retry: 600, Expire: 86400, MinTTL: 60,
+		},
+	}
+	switch {
+	case q.Type == dnsmessage.TypeSOA && q.Name.String() == f.zone:
+		return []dnsmessage.Resource{soa}, nil
+	case q.Type == dnsmessage.TypeA && q.Name.String() == "cdn."+f.zone:
+		return []dnsmessage.Resource{{
+			Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 120},
+			Body:   &dnsmessage.AResource{A: [4]byte{1, 1, 1, 1}},
+		}}, nil
+	}
+	return nil, []dnsmessage.Resource{soa}
+}
+
+func (f *fakeDNS) lastUpdate(t *testing.T) []byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.updates) == 0 {
+		t.Fatal("server received no update")
+	}
+	return f.updates[len(f.updates)-1]
+}
+
+func newTestRFC2136(t *testing.T, server, zone string, signed bool) *rfc2136 {
+	opts := RFC2136Options{Server: server, Zone: zone, TSIGAlgorithm: "hmac-sha256"}
+	if signed {
+		opts.TSIGName = "update-key."
+		opts.TSIGSecret = base64.StdEncoding.EncodeToString(testTSIGSecret)
+	}
+	b, err := newRFC2136(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+type updateRecord struct {
+	header dnsmessage.ResourceHeader
+	data   []byte
+}
+
+type update struct {
+	id          uint16
+	additionals []updateRecord
+}
+
+// checkUpdate parses an UPDATE message and checks that it deletes the A
+// and AAAA RRsets of owner in zone and adds ips.
+func checkUpdate(t *testing.T, raw []byte, zone, owner string, ips []string, ttl uint32) update {
+	t.Helper()
+	var p dnsmessage.Parser
+	h, err := p.Start(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.OpCode != 5 {
+		t.Errorf("opcode = %d, want 5 (UPDATE)", h.OpCode)
+	}
+	questions, err := p.AllQuestions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(questions) != 1 || questions[0].Name.String() != zone || questions[0].Type != dnsmessage.TypeSOA {
+		t.Errorf("zone section = %v, want SOA %s", questions, zone)
+	}
+	answers, err := p.AllAnswers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(answers) != 0 {
+		t.Errorf("prerequisites = %v, want none", answers)
+	}
+
+	var deleted []dnsmessage.Type
+	var added []string
+	for {
+		rh, err := p.AuthorityHeader()
+		if err == dnsmessage.ErrSectionDone {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := p.UnknownResource()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rh.Name.String() != owner {
+			t.Errorf("update for %s, want %s", rh.Name, owner)
+		}
+		if rh.Class == dnsmessage.ClassANY {
+			if rh.TTL != 0 || len(body.Data) != 0 {
+				t.Errorf("delete %v: TTL %d and %d bytes of data, want none", rh.Type, rh.TTL, len(body.Data))
+			}
+			deleted = append(deleted, rh.Type)
+			continue
+		}
+		if rh.Class != dnsmessage.ClassINET || rh.TTL != ttl {
+			t.Errorf("add: header %+v, want class IN and TTL %d", rh, ttl)
+		}
+		switch rh.Type {
+		case dnsmessage.TypeA, dnsmessage.TypeAAAA:
+			added = append(added, net.IP(body.Data).String())
+		default:
+			t.Errorf("unexpected %v record in update", rh.Type)
+		}
+	}
+	if len(deleted) != 2 || deleted[0] != dnsmessage.TypeA || deleted[1] != dnsmessage.TypeAAAA {
+		t.Errorf("deleted RRsets = %v, want A and AAAA", deleted)
+	}
+	if strings.Join(added, ",") != strings.Join(ips, ",") {
+		t.Errorf("added = %v, want %v", added, ips)
+	}
+
+	u := update{id: h.ID}
+	for {
+		rh, err := p.AdditionalHeader()
+		if err == dnsmessage.ErrSectionDone {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := p.UnknownResource()
+		if err != nil {
+			t.Fatal(err)
+		}
+		u.additionals = append(u.additionals, updateRecord{header: rh, data: body.Data})
+	}
+	return u
+}
+
+func TestRFC2136Records(t *testing.T) {
+	srv := newFakeDNS(t, "example.com.")
+	b := newTestRFC2136(t, srv.ln.Addr().String(), "", false)
+
+	records, err := b.Records(context.Background(), "cdn.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0] != (Record{IP: "1.1.1.1", TTL: 120}) {
+		t.Errorf("records = %v", records)
+	}
+}
+
+func TestRFC2136ReplaceFindsZone(t *testing.T) {
+	srv := newFakeDNS(t, "example.com.")
+	b := newTestRFC2136(t, srv.ln.Addr().String(), "", false)
+
+	ips := []string{"2.2.2.2", "2606:4700::1"}
+	if err := b.Replace(context.Background(), "a.cdn.example.com", ips, 60); err != nil {
+		t.Fatal(err)
+	}
+	u := checkUpdate(t, srv.lastUpdate(t), "example.com.", "a.cdn.example.com.", ips, 60)
+	if len(u.additionals) != 0 {
+		t.Errorf("unsigned update has additional records: %v", u.additionals)
+	}
+}
+
+func TestRFC2136ReplaceConfiguredZone(t *testing.T) {
+	srv := newFakeDNS(t, "example.com.")
+	b := newTestRFC2136(t, srv.ln.Addr().String(), "cdn.example.com", false)
+
+	if err := b.Replace(context.Background(), "a.cdn.example.com", []string{"2.2.2.2"}, 60); err != nil {
+		t.Fatal(err)
+	}
+	checkUpdate(t, srv.lastUpdate(t), "cdn.example.com.", "a.cdn.example.com.", []string{"2.2.2.2"}, 60)
+}
+
+func TestRFC2136ReplaceSigned(t *testing.T) {
+	srv := newFakeDNS(t, "example.com.")
+	b := newTestRFC2136(t, srv.ln.Addr().String(), "example.com", true)
+
+	if err := b.Replace(context.Background(), "cdn.example.com", []string{"3.3.3.3"}, 30); err != nil {
+		t.Fatal(err)
+	}
+	raw := srv.lastUpdate(t)
+	u := checkUpdate(t, raw, "example.com.", "cdn.example.com.", []string{"3.3.3.3"}, 30)
+
+	if len(u.additionals) != 1 {
+		t.Fatalf("additional records = %v, want one TSIG", u.additionals)
+	}
+	tsig := u.additionals[0]
+	if tsig.header.Type != tsigType || tsig.header.Name.String() != "update-key." || tsig.header.Class != dnsmessage.ClassANY || tsig.header.TTL != 0 {
+		t.Fatalf("TSIG header = %+v", tsig.header)
+	}
+	rdata := tsig.data
+
+	alg := wireName("hmac-sha256")
+	if string(rdata[:len(alg)]) != string(alg) {
+		t.Fatalf("TSIG algorithm = %q", rdata[:len(alg)])
+	}
+	rest := rdata[len(alg):]
+	timeSigned, fudge := rest[:6], binary.BigEndian.Uint16(rest[6:8])
+	macSize := int(binary.BigEndian.Uint16(rest[8:10]))
+	mac := rest[10 : 10+macSize]
+	tail := rest[10+macSize:]
+	if fudge != tsigFudge {
+		t.Errorf("fudge = %d", fudge)
+	}
+	if binary.BigEndian.Uint16(tail[:2]) != u.id || binary.BigEndian.Uint16(tail[2:4]) != 0 || len(tail) != 6 {
+		t.Errorf("original ID, error and other data = %x", tail)
+	}
+	signed := int64(binary.BigEndian.Uint64(append([]byte{0, 0}, timeSigned...)))
+	if d := time.Now().Unix() - signed; d < 0 || d > 60 {
+		t.Errorf("time signed is %ds off", d)
+	}
+
+	// RFC 8945: the MAC covers the message without the TSIG record, with
+	// ARCOUNT decremented, followed by the TSIG variables.
+	keyName := wireName("update-key.")
+	unsigned := append([]byte(nil), raw[:len(raw)-(len(keyName)+10+len(rdata))]...)
+	binary.BigEndian.PutUint16(unsigned[10:12], binary.BigEndian.Uint16(unsigned[10:12])-1)
+
+	h := hmac.New(sha256.New, testTSIGSecret)
+	h.Write(unsigned)
+	h.Write(keyName)
+	h.Write([]byte{0, 255, 0, 0, 0, 0})
+	h.Write(alg)
+	h.Write(timeSigned)
+	h.Write(rest[6:8])
+	h.Write([]byte{0, 0, 0, 0})
+	if !hmac.Equal(mac, h.Sum(nil)) {
+		t.Errorf("TSIG MAC does not verify")
+	}
+}
+
+func TestRFC2136ReplaceRefused(t *testing.T) {
+	srv := newFakeDNS(t, "example.com.")
+	srv.rcode = dnsmessage.RCodeRefused
+	b := newTestRFC2136(t, srv.ln.Addr().String(), "example.com", false)
+
+	err := b.Replace(context.Background(), "cdn.example.com", []string{"2.2.2.2"}, 60)
+	if err == nil || !strings.Contains(err.Error(), "update refused") {
+		t.Errorf("err = %v", err)
+	}
+}
\ No newline at end of file
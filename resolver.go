@@ -0,0 +1,31 @@
+package main
+
+import (
+	"github.com/fatih/color"
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/config"
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/resolver"
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/scanner"
+)
+
+func writeHostsFile(settings *config.Settings, results []scanner.IPResult) {
+	opts := settings.Resolver
+	if opts.HostsFile == "" || len(opts.Domains) == 0 || len(results) == 0 {
+		return
+	}
+	if err := resolver.WriteHostsFile(opts.HostsFile, opts.Domains, results[0].IP.String()); err != nil {
+		color.New(color.FgRed).Printf("Error saving hosts file: %v\n", err)
+		return
+	}
+	color.New(color.FgGreen).Printf("Hosts entries saved to %s\n", opts.HostsFile)
+}
+
+func startResolver(settings *config.Settings, source func() []scanner.IPResult) {
+	server := resolver.New(settings.Resolver, source)
+	go func() {
+		if err := server.ListenAndServe(); err != nil {
+			color.New(color.FgRed).Printf("DNS server stopped: %v\n", err)
+		}
+	}()
+	color.New(color.FgCyan).Printf("DNS server listening on %s (udp/tcp) for %d domain(s)\n",
+		settings.Resolver.Listen, len(settings.Resolver.Domains))
+}
\ No newline at end of file
@@ -0,0 +1,27 @@
+package resolver
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// WriteHostsFile writes hosts-file lines mapping every domain to ip.
+// Wildcard domains cannot be expressed in a hosts file and are skipped.
+func WriteHostsFile(path string, domains []string, ip string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Generated by CF Clean IP Scanner on %s\n", time.Now().Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(&b, "# Append these lines to /etc/hosts (or /system/etc/hosts on rooted Android).\n")
+	for _, d := range domains {
+		d = strings.TrimSuffix(strings.TrimSpace(d), ".")
+		if d == "" || strings.HasPrefix(d, "*") {
+			continue
+		}
+		fmt.Fprintf(&b, "%s\t%s\n", ip, d)
+	}
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		return fmt.Errorf("cannot write hosts file: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package resolver
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteHostsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts")
+	if err := WriteHostsFile(path, []string{"example.com.", " www.example.com ", "*.example.net", ""}, "1.1.1.1"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if !strings.HasPrefix(line, "#") {
+			entries = append(entries, line)
+		}
+	}
+	want := []string{"1.1.1.1\texample.com", "1.1.1.1\twww.example.com"}
+	if strings.Join(entries, "\n") != strings.Join(want, "\n") {
+		t.Errorf("entries = %q, want %q", entries, want)
+	}
+
+	if err := WriteHostsFile(filepath.Join(path, "missing", "hosts"), nil, "1.1.1.1"); err == nil {
+		t.Error("writing into a missing directory succeeded")
+	}
+}
\ No newline at end of file
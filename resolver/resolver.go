@@ -0,0 +1,266 @@
+package resolver
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/scanner"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+type Options struct {
+	Domains    []string `json:"domains"`
+	HostsFile  string   `json:"hosts_file"`
+	DNSEnabled bool     `json:"dns_enabled"`
+	Listen     string   `json:"listen"`
+	Upstream   string   `json:"upstream"`
+	TTL        int      `json:"ttl"`
+	Answers    int      `json:"answers"`
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Listen:   "127.0.0.1:5353",
+		Upstream: "1.1.1.1:53",
+		TTL:      60,
+		Answers:  2,
+	}
+}
+
+const upstreamTimeout = 5 * time.Second
+
+// Server is a small DNS server that answers queries for the configured
+// Cloudflare-fronted domains with the current best IPs and forwards every
+// other query to the upstream resolver.
+type Server struct {
+	opts    Options
+	source  func() []scanner.IPResult
+	domains map[string]bool
+	suffix  []string
+}
+
+// New creates a server answering with the IPs returned by source, which is
+// called for every query.
+func New(opts Options, source func() []scanner.IPResult) *Server {
+	s := &Server{opts: opts, source: source, domains: make(map[string]bool)}
+	for _, d := range opts.Domains {
+		d = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(d), "."))
+		if strings.HasPrefix(d, "*.") {
+			s.suffix = append(s.suffix, d[1:])
+		} else if d != "" {
+			s.domains[d] = true
+		}
+	}
+	return s
+}
+
+func (s *Server) matches(name string) bool {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	if s.domains[name] {
+		return true
+	}
+	for _, suf := range s.suffix {
+		if strings.HasSuffix(name, suf) {
+			return true
+		}
+	}
+	return false
+}
+
+// ListenAndServe answers queries over both UDP and TCP until one of the
+// listeners fails.
+func (s *Server) ListenAndServe() error {
+	pc, err := net.ListenPacket("udp", s.opts.Listen)
+	if err != nil {
+		return err
+	}
+	defer pc.Close()
+	ln, err := net.Listen("tcp", s.opts.Listen)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+
+	errCh := make(chan error, 2)
+	go func() { errCh <- s.serveUDP(pc) }()
+	go func() { errCh <- s.serveTCP(ln) }()
+	return <-errCh
+}
+
+func (s *Server) serveUDP(pc net.PacketConn) error {
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		query := append([]byte(nil), buf[:n]...)
+		go func() {
+			resp := s.handle(query, "udp")
+			if resp != nil {
+				pc.WriteTo(resp, addr)
+			}
+		}()
+	}
+}
+
+func (s *Server) serveTCP(ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			for {
+				conn.SetDeadline(time.Now().Add(10 * time.Second))
+				query, err := readTCPMessage(conn)
+				if err != nil {
+					return
+				}
+				resp := s.handle(query, "tcp")
+				if resp == nil {
+					return
+				}
+				framed := binary.BigEndian.AppendUint16(nil, uint16(len(resp)))
+				if _, err := conn.Write(append(framed, resp...)); err != nil {
+					return
+				}
+			}
+		}()
+	}
+}
+
+func readTCPMessage(r io.Reader) ([]byte, error) {
+	var length [2]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func (s *Server) handle(query []byte, network string) []byte {
+	var p dnsmessage.Parser
+	header, err := p.Start(query)
+	if err != nil {
+		return nil
+	}
+	q, err := p.Question()
+	if err != nil || header.Response {
+		return nil
+	}
+
+	if s.matches(q.Name.String()) {
+		if ips := s.bestIPs(); len(ips) > 0 {
+			resp, err := s.answer(header, q, ips)
+			if err == nil {
+				return resp
+			}
+		}
+	}
+	if s.opts.Upstream != "" {
+		if resp, err := forward(query, s.opts.Upstream, network); err == nil {
+			return resp
+		}
+		return reply(header, q, dnsmessage.RCodeServerFailure)
+	}
+	return reply(header, q, dnsmessage.RCodeRefused)
+}
+
+func (s *Server) bestIPs() []net.IP {
+	var ips []net.IP
+	for _, r := range s.source() {
+		if s.opts.Answers > 0 && len(ips) >= s.opts.Answers {
+			break
+		}
+		ips = append(ips, r.IP.IP)
+	}
+	return ips
+}
+
+// answer returns the IPs matching the query type. Other types get an empty
+// NOERROR answer so clients fall back to A/AAAA instead of asking upstream.
+func (s *Server) answer(header dnsmessage.Header, q dnsmessage.Question, ips []net.IP) ([]byte, error) {
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{
+		ID:                 header.ID,
+		Response:           true,
+		Authoritative:      true,
+		RecursionDesired:   header.RecursionDesired,
+		RecursionAvailable: true,
+	})
+	b.EnableCompression()
+	b.StartQuestions()
+	b.Question(q)
+	b.StartAnswers()
+
+	h := dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: uint32(s.opts.TTL)}
+	for _, ip := range ips {
+		ip4 := ip.To4()
+		switch {
+		case q.Type == dnsmessage.TypeA && ip4 != nil:
+			var a dnsmessage.AResource
+			copy(a.A[:], ip4)
+			if err := b.AResource(h, a); err != nil {
+				return nil, err
+			}
+		case q.Type == dnsmessage.TypeAAAA && ip4 == nil:
+			var aaaa dnsmessage.AAAAResource
+			copy(aaaa.AAAA[:], ip.To16())
+			if err := b.AAAAResource(h, aaaa); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return b.Finish()
+}
+
+func reply(header dnsmessage.Header, q dnsmessage.Question, rcode dnsmessage.RCode) []byte {
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{
+		ID:               header.ID,
+		Response:         true,
+		RecursionDesired: header.RecursionDesired,
+		RCode:            rcode,
+	})
+	b.StartQuestions()
+	b.Question(q)
+	msg, _ := b.Finish()
+	return msg
+}
+
+func forward(query []byte, upstream, network string) ([]byte, error) {
+	conn, err := net.DialTimeout(network, upstream, upstreamTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(upstreamTimeout))
+
+	if network == "tcp" {
+		framed := binary.BigEndian.AppendUint16(nil, uint16(len(query)))
+		if _, err := conn.Write(append(framed, query...)); err != nil {
+			return nil, err
+		}
+		return readTCPMessage(conn)
+	}
+
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 65535)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	if n < 2 || binary.BigEndian.Uint16(buf) != binary.BigEndian.Uint16(query) {
+		return nil, fmt.Errorf("unexpected response from %s", upstream)
+	}
+	return buf[:n], nil
+}
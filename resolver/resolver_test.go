@@ -0,0 +1,240 @@
+package resolver
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/scanner"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func testResults(ips ...string) func() []scanner.IPResult {
+	return func() []scanner.IPResult {
+		var results []scanner.IPResult
+		for _, ip := range ips {
+			results = append(results, scanner.IPResult{IP: &net.IPAddr{IP: net.ParseIP(ip)}})
+		}
+		return results
+	}
+}
+
+// startServer serves s over UDP and TCP on ports of the loopback address
+// and returns their addresses.
+func startServer(t *testing.T, s *Server) (udpAddr, tcpAddr string) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		pc.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		pc.Close()
+		ln.Close()
+	})
+	go s.serveUDP(pc)
+	go s.serveTCP(ln)
+	return pc.LocalAddr().String(), ln.Addr().String()
+}
+
+// fakeUpstream answers every UDP query with one A record of ip.
+func fakeUpstream(t *testing.T, ip [4]byte) string {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var query dnsmessage.Message
+			if err := query.Unpack(buf[:n]); err != nil || len(query.Questions) != 1 {
+				continue
+			}
+			q := query.Questions[0]
+			resp := dnsmessage.Message{
+				Header:    dnsmessage.Header{ID: query.ID, Response: true, RecursionAvailable: true},
+				Questions: []dnsmessage.Question{q},
+				Answers: []dnsmessage.Resource{{
+					Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 300},
+					Body:   &dnsmessage.AResource{A: ip},
+				}},
+			}
+			packed, err := resp.Pack()
+			if err != nil {
+				continue
+			}
+			pc.WriteTo(packed, addr)
+		}
+	}()
+	return pc.LocalAddr().String()
+}
+
+func exchange(t *testing.T, network, addr, name string, qtype dnsmessage.Type) dnsmessage.Message {
+	t.Helper()
+	query := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: 0x1234, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{
+			Name:  dnsmessage.MustNewName(name),
+			Type:  qtype,
+			Class: dnsmessage.ClassINET,
+		}},
+	}
+	packed, err := query.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	var raw []byte
+	if network == "tcp" {
+		if _, err := conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(packed))), packed...)); err != nil {
+			t.Fatal(err)
+		}
+		if raw, err = readTCPMessage(conn); err != nil {
+			t.Fatal(err)
+		}
+	} else {
+		if _, err := conn.Write(packed); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, 65535)
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw = buf[:n]
+	}
+
+	var resp dnsmessage.Message
+	if err := resp.Unpack(raw); err != nil {
+		t.Fatal(err)
+	}
+	if resp.ID != query.ID || !resp.Response {
+		t.Fatalf("%s %v: header %+v", name, qtype, resp.Header)
+	}
+	return resp
+}
+
+// answerIPs returns the addresses of the A and AAAA answers of resp.
+func answerIPs(resp dnsmessage.Message) []string {
+	var ips []string
+	for _, a := range resp.Answers {
+		switch body := a.Body.(type) {
+		case *dnsmessage.AResource:
+			ips = append(ips, net.IP(body.A[:]).String())
+		case *dnsmessage.AAAAResource:
+			ips = append(ips, net.IP(body.AAAA[:]).String())
+		}
+	}
+	return ips
+}
+
+func TestMatches(t *testing.T) {
+	s := New(Options{Domains: []string{"Example.com.", "*.cdn.example.net", " "}}, testResults())
+	for name, want := range map[string]bool{
+		"example.com.":           true,
+		"EXAMPLE.COM":            true,
+		"www.example.com.":       false,
+		"a.cdn.example.net.":     true,
+		"a.b.CDN.example.net.":   true,
+		"cdn.example.net.":       false,
+		"badcdn.example.net.":    false,
+		"cdn.example.net.other.": false,
+	} {
+		if got := s.matches(name); got != want {
+			t.Errorf("matches(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestServerAnswers(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Domains = []string{"example.com", "*.example.net"}
+	opts.Upstream = ""
+	s := New(opts, testResults("1.1.1.1", "2606:4700::1", "1.0.0.1", "1.1.1.2"))
+	udpAddr, tcpAddr := startServer(t, s)
+
+	for _, network := range []string{"udp", "tcp"} {
+		addr := udpAddr
+		if network == "tcp" {
+			addr = tcpAddr
+		}
+
+		resp := exchange(t, network, addr, "www.example.net.", dnsmessage.TypeA)
+		if got := answerIPs(resp); len(got) != 1 || got[0] != "1.1.1.1" || !resp.Authoritative {
+			t.Errorf("%s A: answers %v, authoritative %v", network, got, resp.Authoritative)
+		}
+		if resp.Answers[0].Header.TTL != uint32(opts.TTL) {
+			t.Errorf("%s A: TTL %d, want %d", network, resp.Answers[0].Header.TTL, opts.TTL)
+		}
+
+		resp = exchange(t, network, addr, "example.com.", dnsmessage.TypeAAAA)
+		if got := answerIPs(resp); len(got) != 1 || got[0] != "2606:4700::1" {
+			t.Errorf("%s AAAA: answers %v", network, got)
+		}
+
+		resp = exchange(t, network, addr, "example.com.", dnsmessage.TypeMX)
+		if resp.RCode != dnsmessage.RCodeSuccess || len(resp.Answers) != 0 {
+			t.Errorf("%s MX: rcode %v with %d answers, want an empty NOERROR answer", network, resp.RCode, len(resp.Answers))
+		}
+
+		resp = exchange(t, network, addr, "example.org.", dnsmessage.TypeA)
+		if resp.RCode != dnsmessage.RCodeRefused {
+			t.Errorf("%s other name without upstream: rcode %v, want %v", network, resp.RCode, dnsmessage.RCodeRefused)
+		}
+	}
+}
+
+func TestServerForwards(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Domains = []string{"example.com"}
+	opts.Upstream = fakeUpstream(t, [4]byte{9, 9, 9, 9})
+	udpAddr, _ := startServer(t, New(opts, testResults("1.1.1.1")))
+
+	resp := exchange(t, "udp", udpAddr, "example.org.", dnsmessage.TypeA)
+	if got := answerIPs(resp); len(got) != 1 || got[0] != "9.9.9.9" {
+		t.Errorf("forwarded answers %v, want the upstream's", got)
+	}
+	resp = exchange(t, "udp", udpAddr, "example.com.", dnsmessage.TypeA)
+	if got := answerIPs(resp); len(got) != 1 || got[0] != "1.1.1.1" {
+		t.Errorf("configured domain answers %v, want the scanned IP", got)
+	}
+
+	// With no scan results the configured domains are resolved upstream.
+	udpAddr, _ = startServer(t, New(opts, testResults()))
+	resp = exchange(t, "udp", udpAddr, "example.com.", dnsmessage.TypeA)
+	if got := answerIPs(resp); len(got) != 1 || got[0] != "9.9.9.9" {
+		t.Errorf("answers without results %v, want the upstream's", got)
+	}
+}
+
+func TestServerUpstreamDown(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstream := pc.LocalAddr().String()
+	pc.Close()
+
+	opts := DefaultOptions()
+	opts.Upstream = upstream
+	udpAddr, _ := startServer(t, New(opts, testResults()))
+	resp := exchange(t, "udp", udpAddr, "example.org.", dnsmessage.TypeA)
+	if resp.RCode != dnsmessage.RCodeServerFailure {
+		t.Errorf("rcode %v, want %v", resp.RCode, dnsmessage.RCodeServerFailure)
+	}
+}
\ No newline at end of file
@@ -0,0 +1,248 @@
+package scanner
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ApplyConfig controls how scan results are written back into
+// config/xray_config.json.
+type ApplyConfig struct {
+	Enabled bool `json:"enabled"`
+	Backup  bool `json:"backup"`
+	// Balancer writes the top IPs as copies of the proxy outbound behind a
+	// routing balancer, with an observatory picking the fastest one.
+	Balancer         bool   `json:"balancer"`
+	BalancerSize     int    `json:"balancer_size"`
+	BalancerTag      string `json:"balancer_tag"`
+	BalancerStrategy string `json:"balancer_strategy"`
+	ProbeURL         string `json:"probe_url"`
+	ProbeInterval    string `json:"probe_interval"`
+}
+
+func DefaultApplyConfig() ApplyConfig {
+	return ApplyConfig{
+		Backup:           true,
+		BalancerSize:     3,
+		BalancerTag:      "clean-ips",
+		BalancerStrategy: "leastPing",
+		ProbeURL:         "https://cp.cloudflare.com/generate_204",
+		ProbeInterval:    "1m",
+	}
+}
+
+const defaultProxyTag = "proxy"
+
+// ApplyResult describes what ApplyIPs changed.
+type ApplyResult struct {
+	Path       string
+	BackupPath string
+	IPs        []string
+}
+
+// ApplyIPs points the proxy outbound of the user's Xray config at ips[0].
+// With c.Balancer set, up to c.BalancerSize IPs are added as copies of the
+// proxy outbound grouped under a balancer. All other fields are kept, in
+// the order and indentation of the file.
+func ApplyIPs(ips []string, c ApplyConfig) (*ApplyResult, error) {
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no IPs to apply")
+	}
+	original, err := os.ReadFile(xrayConfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read config: %v", err)
+	}
+	doc, err := parseConfigDoc(original)
+	if err != nil {
+		return nil, err
+	}
+	cfg := doc.root
+	proxyOutbound, _, err := findProxyOutbound(cfg)
+	if err != nil {
+		return nil, err
+	}
+	port := outboundPort(proxyOutbound)
+	if _, err := setOutboundAddress(proxyOutbound, ips[0], port); err != nil {
+		return nil, err
+	}
+
+	result := &ApplyResult{Path: xrayConfigPath, IPs: ips[:1]}
+	if c.Balancer && c.BalancerSize > 1 && len(ips) > 1 {
+		n := c.BalancerSize
+		if n > len(ips) {
+			n = len(ips)
+		}
+		if err := addBalancer(doc, proxyOutbound, ips[:n], port, c); err != nil {
+			return nil, err
+		}
+		result.IPs = ips[:n]
+	}
+
+	data, err := doc.marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Backup {
+		result.BackupPath, err = writeBackup(xrayConfigPath, original)
+		if err != nil {
+			return nil, fmt.Errorf("cannot write backup: %v", err)
+		}
+	}
+	if err := writeFileAtomic(xrayConfigPath, data); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// addBalancer clones proxy for every IP after the first and routes the
+// traffic that used to go to proxy through a balancer over all of them.
+// Copies left over from an earlier run are replaced.
+func addBalancer(doc *configDoc, proxy map[string]interface{}, ips []string, port int, c ApplyConfig) error {
+	cfg := doc.root
+	tag := stringField(proxy, "tag")
+	if tag == "" {
+		tag = defaultProxyTag
+		proxy["tag"] = tag
+	}
+	altPrefix := tag + "-alt-"
+
+	outbounds, _ := cfg["outbounds"].([]interface{})
+	isDefault := false
+	var kept []interface{}
+	for i, out := range outbounds {
+		outMap, _ := out.(map[string]interface{})
+		if strings.HasPrefix(stringField(outMap, "tag"), altPrefix) {
+			continue
+		}
+		if i == 0 && stringField(outMap, "tag") == tag {
+			isDefault = true
+		}
+		kept = append(kept, out)
+	}
+
+	selector := []interface{}{tag}
+	for i, ip := range ips[1:] {
+		clone := doc.clone(proxy).(map[string]interface{})
+		altTag := fmt.Sprintf("%s%d", altPrefix, i+2)
+		clone["tag"] = altTag
+		if _, err := setOutboundAddress(clone, ip, port); err != nil {
+			return err
+		}
+		kept = append(kept, clone)
+		selector = append(selector, altTag)
+	}
+	cfg["outbounds"] = kept
+
+	routing := subMap(cfg, "routing")
+	var balancers []interface{}
+	if list, ok := routing["balancers"].([]interface{}); ok {
+		for _, b := range list {
+			if bMap, _ := b.(map[string]interface{}); stringField(bMap, "tag") != c.BalancerTag {
+				balancers = append(balancers, b)
+			}
+		}
+	}
+	balancers = append(balancers, map[string]interface{}{
+		"tag":      c.BalancerTag,
+		"selector": selector,
+		"strategy": map[string]interface{}{"type": c.BalancerStrategy},
+	})
+	routing["balancers"] = balancers
+
+	rules, _ := routing["rules"].([]interface{})
+	hasCatchAll := false
+	for _, r := range rules {
+		rule, ok := r.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if stringField(rule, "outboundTag") == tag {
+			delete(rule, "outboundTag")
+			rule["balancerTag"] = c.BalancerTag
+		}
+		if stringField(rule, "balancerTag") == c.BalancerTag && stringField(rule, "network") == "tcp,udp" && len(rule) <= 3 {
+			hasCatchAll = true
+		}
+	}
+	// Unmatched traffic goes to the first outbound, which bypasses the
+	// balancer, so send it there explicitly when proxy was the default.
+	if isDefault && !hasCatchAll {
+		rules = append(rules, map[string]interface{}{
+			"type":        "field",
+			"network":     "tcp,udp",
+			"balancerTag": c.BalancerTag,
+		})
+	}
+	routing["rules"] = rules
+	cfg["routing"] = routing
+
+	cfg["observatory"] = map[string]interface{}{
+		"subjectSelector":   selector,
+		"probeURL":          c.ProbeURL,
+		"probeInterval":     c.ProbeInterval,
+		"enableConcurrency": true,
+	}
+	return nil
+}
+
+// writeBackup stores data next to path under a timestamped name, never
+// replacing an earlier backup.
+func writeBackup(path string, data []byte) (string, error) {
+	base := fmt.Sprintf("%s.%s", path, time.Now().Format("20060102-150405"))
+	name := base + ".bak"
+	for i := 1; ; i++ {
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			name = fmt.Sprintf("%s-%d.bak", base, i)
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		_, err = f.Write(data)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		return name, err
+	}
+}
+
+func cloneOutbound(outbound map[string]interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(outbound)
+	if err != nil {
+		return nil, err
+	}
+	var clone map[string]interface{}
+	if err := json.Unmarshal(data, &clone); err != nil {
+		return nil, err
+	}
+	return clone, nil
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("cannot write config: %v", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("cannot write config: %v", err)
+	}
+	tmp.Close()
+	os.Chmod(tmp.Name(), mode)
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("cannot write config: %v", err)
+	}
+	return nil
+}
\ No newline at end of file
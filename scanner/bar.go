@@ -2,6 +2,8 @@ package scanner
 
 import (
 	"fmt"
+	"io"
+	"os"
 
 	"github.com/cheggaaa/pb/v3"
 )
@@ -10,16 +12,53 @@ type Bar struct {
 	bar *pb.ProgressBar
 }
 
+var barsEnabled = true
+
+// SetProgressBars turns the terminal progress bars on or off, for callers
+// that render progress themselves.
+func SetProgressBars(enabled bool) {
+	barsEnabled = enabled
+}
+
+var output io.Writer = os.Stdout
+
+// SetOutput sets where the scanner prints its plain, uncolored lines.
+// Colored lines go to color.Output as usual.
+func SetOutput(w io.Writer) {
+	output = w
+}
+
+// Output returns the writer set with SetOutput.
+func Output() io.Writer {
+	return output
+}
+
 func newBar(count int, myStrStart, myStrEnd string) *Bar {
-	tmpl := fmt.Sprintf(`{{counters . }} {{ bar . "[" "-" (cycle . "↖" "↗" "↘" "↙" ) "_" "]"}} %s {{string . "MyStr" | green}} %s {{rtime . | blue}}`, myStrStart, myStrEnd)
+	if !barsEnabled {
+		return &Bar{}
+	}
+	tmpl := fmt.Sprintf(`{{counters . }} {{ bar . "[" "-" (cycle . "↖" "↗" "↘" "↙" ) "_" "]"}} %s {{string . "MyStr" | green}} %s {{string . "Extra" | cyan}} {{rtime . | blue}}`, myStrStart, myStrEnd)
 	b := pb.ProgressBarTemplate(tmpl).Start(count)
 	return &Bar{bar: b}
 }
 
 func (b *Bar) grow(num int, myStrVal string) {
+	if b.bar == nil {
+		return
+	}
 	b.bar.Set("MyStr", myStrVal).Add(num)
 }
 
+func (b *Bar) setExtra(val string) {
+	if b.bar == nil {
+		return
+	}
+	b.bar.Set("Extra", val)
+}
+
 func (b *Bar) done() {
+	if b.bar == nil {
+		return
+	}
 	b.bar.Finish()
 }
\ No newline at end of file
@@ -0,0 +1,83 @@
+package scanner
+
+import (
+	"net"
+	"sync"
+)
+
+// TunnelResult is how an IP did through Xray with the user's config in
+// combined mode. Delay is in milliseconds and DownloadSpeed in bytes per
+// second, as in IPResult. An IP that did not answer through Xray has a
+// zero TunnelResult; one the scan was interrupted before checking has
+// none. DownloadSpeed is only measured when SpeedTested is set.
+type TunnelResult struct {
+	Sended        int
+	Received      int
+	LossRate      float32
+	Delay         int
+	DownloadSpeed float64
+	SpeedTested   bool
+	Failures      FailureCounts
+}
+
+// OK reports whether the IP carried the tunnel.
+func (t *TunnelResult) OK() bool {
+	return t != nil && t.Received > 0
+}
+
+// validateThroughXray runs the Xray latency and speed tests on the IPs of
+// results and attaches what they measured to each result. The tests leave
+// out the IPs that fail, so the IPDone events tell which IPs they got to
+// before stopCh was closed.
+func validateThroughXray(stopCh <-chan struct{}, results []IPResult) {
+	ips := make([]*net.IPAddr, len(results))
+	for i, r := range results {
+		ips[i] = r.IP
+	}
+
+	var mu sync.Mutex
+	done := map[Phase]map[string]bool{
+		PhaseXrayPing:  make(map[string]bool),
+		PhaseXraySpeed: make(map[string]bool),
+	}
+	unsubscribe := Subscribe(func(e Event) {
+		if e.Type != EventIPDone || done[e.Phase] == nil {
+			return
+		}
+		mu.Lock()
+		done[e.Phase][e.IP.String()] = true
+		mu.Unlock()
+	})
+	pingResults := PingIPsViaXray(stopCh, ips)
+	var speedResults []IPResult
+	if len(pingResults) > 0 {
+		c := opts.Speed
+		c.Wanted, c.MaxTest = len(pingResults), 0
+		speedResults = SpeedTestViaXrayWith(stopCh, pingResults, c)
+	}
+	unsubscribe()
+
+	tunnels := make(map[string]*TunnelResult, len(pingResults))
+	for _, pr := range pingResults {
+		key := pr.IP.String()
+		tunnels[key] = &TunnelResult{
+			Sended:      pr.Sended,
+			Received:    pr.Received,
+			LossRate:    pr.GetLossRate(),
+			Delay:       int(pr.Delay.Milliseconds()),
+			SpeedTested: done[PhaseXraySpeed][key],
+			Failures:    pr.Failures,
+		}
+	}
+	for _, r := range speedResults {
+		tunnels[r.IP.String()].DownloadSpeed = r.DownloadSpeed
+	}
+	for i := range results {
+		key := results[i].IP.String()
+		if t, ok := tunnels[key]; ok {
+			results[i].Tunnel = t
+		} else if done[PhaseXrayPing][key] {
+			results[i].Tunnel = &TunnelResult{}
+		}
+	}
+}
\ No newline at end of file
@@ -0,0 +1,157 @@
+package scanner
+
+import (
+	"sync"
+)
+
+type ConcurrencyConfig struct {
+	Adaptive bool `json:"adaptive"`
+	Initial  int  `json:"initial"`
+	Min      int  `json:"min"`
+	Max      int  `json:"max"`
+
+	// Window is the number of recent probes the timeout ratio is measured
+	// over. Concurrency is re-evaluated once per full window.
+	Window         int     `json:"window"`
+	BackoffRatio   float64 `json:"backoff_ratio"`
+	IncreaseStep   int     `json:"increase_step"`
+	DecreaseFactor float64 `json:"decrease_factor"`
+}
+
+func DefaultConcurrencyConfig() ConcurrencyConfig {
+	return ConcurrencyConfig{
+		Adaptive:       true,
+		Initial:        200,
+		Min:            20,
+		Max:            600,
+		Window:         100,
+		BackoffRatio:   0.9,
+		IncreaseStep:   10,
+		DecreaseFactor: 0.5,
+	}
+}
+
+// adaptiveLimiter is a semaphore whose size follows an AIMD rule: it grows
+// by a fixed step while probes mostly get answers and is cut by a factor
+// when nearly all of them time out, which is what ISP-side SYN rate
+// limiting looks like from here.
+type adaptiveLimiter struct {
+	mu       sync.Mutex
+	cfg      ConcurrencyConfig
+	limit    int
+	active   int
+	outcomes []bool
+	next     int
+	filled   int
+	pending  int
+	wake     chan struct{}
+}
+
+func newAdaptiveLimiter(cfg ConcurrencyConfig) *adaptiveLimiter {
+	if cfg.Min < 1 {
+		cfg.Min = 1
+	}
+	if cfg.Max < cfg.Min {
+		cfg.Max = cfg.Min
+	}
+	if cfg.Window < 1 {
+		cfg.Window = 1
+	}
+	limit := cfg.Initial
+	if limit < cfg.Min {
+		limit = cfg.Min
+	}
+	if limit > cfg.Max {
+		limit = cfg.Max
+	}
+	return &adaptiveLimiter{
+		cfg:      cfg,
+		limit:    limit,
+		outcomes: make([]bool, cfg.Window),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+func (l *adaptiveLimiter) signal() {
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
+
+// acquire blocks until a slot is free or stopCh is closed, in which case it
+// returns false.
+func (l *adaptiveLimiter) acquire(stopCh <-chan struct{}) bool {
+	for {
+		l.mu.Lock()
+		if l.active < l.limit {
+			l.active++
+			l.mu.Unlock()
+			return true
+		}
+		l.mu.Unlock()
+
+		select {
+		case <-stopCh:
+			return false
+		case <-l.wake:
+		}
+	}
+}
+
+func (l *adaptiveLimiter) release() {
+	l.mu.Lock()
+	l.active--
+	l.mu.Unlock()
+	l.signal()
+}
+
+// record feeds the outcome of a single probe into the sliding window.
+func (l *adaptiveLimiter) record(timedOut bool) {
+	if !l.cfg.Adaptive {
+		return
+	}
+
+	l.mu.Lock()
+	l.outcomes[l.next] = timedOut
+	l.next = (l.next + 1) % len(l.outcomes)
+	if l.filled < len(l.outcomes) {
+		l.filled++
+	}
+	l.pending++
+
+	grew := false
+	if l.pending >= len(l.outcomes) {
+		l.pending = 0
+		timeouts := 0
+		for i := 0; i < l.filled; i++ {
+			if l.outcomes[i] {
+				timeouts++
+			}
+		}
+		ratio := float64(timeouts) / float64(l.filled)
+		if ratio >= l.cfg.BackoffRatio {
+			l.limit = int(float64(l.limit) * l.cfg.DecreaseFactor)
+			if l.limit < l.cfg.Min {
+				l.limit = l.cfg.Min
+			}
+		} else if l.limit < l.cfg.Max {
+			l.limit += l.cfg.IncreaseStep
+			if l.limit > l.cfg.Max {
+				l.limit = l.cfg.Max
+			}
+			grew = true
+		}
+	}
+	l.mu.Unlock()
+
+	if grew {
+		l.signal()
+	}
+}
+
+func (l *adaptiveLimiter) current() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
\ No newline at end of file
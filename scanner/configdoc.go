@@ -0,0 +1,205 @@
+package scanner
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// configDoc is a decoded JSON file that remembers the key order of every
+// object and the indentation of the file, so that writing it back only
+// changes what was edited. Objects added while editing keep Go's sorted
+// key order.
+type configDoc struct {
+	root    map[string]interface{}
+	order   map[uintptr][]string
+	indent  string
+	newline bool
+}
+
+func parseConfigDoc(data []byte) (*configDoc, error) {
+	d := &configDoc{
+		order:   make(map[uintptr][]string),
+		indent:  detectIndent(data),
+		newline: bytes.HasSuffix(data, []byte("\n")),
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	v, err := d.decode(dec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON in config: %v", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("invalid JSON in config: unexpected data after the top-level object")
+	}
+	root, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid JSON in config: top level is not an object")
+	}
+	d.root = root
+	return d, nil
+}
+
+// detectIndent returns the leading white space of the first indented
+// line, or two spaces when there is none.
+func detectIndent(data []byte) string {
+	for _, line := range strings.Split(string(data), "\n")[1:] {
+		if trimmed := strings.TrimLeft(line, " \t"); trimmed != "" && len(trimmed) < len(line) {
+			return line[:len(line)-len(trimmed)]
+		}
+	}
+	return "  "
+}
+
+func mapKey(m map[string]interface{}) uintptr {
+	return reflect.ValueOf(m).Pointer()
+}
+
+func (d *configDoc) decode(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		m := make(map[string]interface{})
+		var keys []string
+		for dec.More() {
+			t, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			key := t.(string)
+			v, err := d.decode(dec)
+			if err != nil {
+				return nil, err
+			}
+			if _, dup := m[key]; !dup {
+				keys = append(keys, key)
+			}
+			m[key] = v
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		d.order[mapKey(m)] = keys
+		return m, nil
+	case json.Delim('['):
+		list := []interface{}{}
+		for dec.More() {
+			v, err := d.decode(dec)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return list, nil
+	}
+	return tok, nil
+}
+
+// clone returns a deep copy of v whose objects keep the key order of the
+// originals.
+func (d *configDoc) clone(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[k] = d.clone(e)
+		}
+		if keys, ok := d.order[mapKey(v)]; ok {
+			d.order[mapKey(m)] = append([]string(nil), keys...)
+		}
+		return m
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, e := range v {
+			list[i] = d.clone(e)
+		}
+		return list
+	}
+	return v
+}
+
+// keys returns the keys of m in file order, followed by the keys added
+// since in sorted order.
+func (d *configDoc) keys(m map[string]interface{}) []string {
+	known := d.order[mapKey(m)]
+	keys := make([]string, 0, len(m))
+	seen := make(map[string]bool, len(known))
+	for _, k := range known {
+		if _, ok := m[k]; ok {
+			keys = append(keys, k)
+			seen[k] = true
+		}
+	}
+	var added []string
+	for k := range m {
+		if !seen[k] {
+			added = append(added, k)
+		}
+	}
+	sort.Strings(added)
+	return append(keys, added...)
+}
+
+func (d *configDoc) encode(b *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		b.WriteByte('{')
+		for i, k := range d.keys(v) {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			if err := d.encode(b, k); err != nil {
+				return err
+			}
+			b.WriteByte(':')
+			if err := d.encode(b, v[k]); err != nil {
+				return err
+			}
+		}
+		b.WriteByte('}')
+	case []interface{}:
+		b.WriteByte('[')
+		for i, e := range v {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			if err := d.encode(b, e); err != nil {
+				return err
+			}
+		}
+		b.WriteByte(']')
+	default:
+		enc := json.NewEncoder(b)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+		b.Truncate(b.Len() - 1)
+	}
+	return nil
+}
+
+// marshal encodes the document with the indentation of the original file.
+func (d *configDoc) marshal() ([]byte, error) {
+	var compact bytes.Buffer
+	if err := d.encode(&compact, d.root); err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, compact.Bytes(), "", d.indent); err != nil {
+		return nil, err
+	}
+	if d.newline {
+		out.WriteByte('\n')
+	}
+	return out.Bytes(), nil
+}
\ No newline at end of file
@@ -0,0 +1,113 @@
+package scanner
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+type Phase string
+
+const (
+	PhasePing      Phase = "ping"
+	PhaseSpeed     Phase = "speed"
+	PhaseXrayPing  Phase = "xray-ping"
+	PhaseXraySpeed Phase = "xray-speed"
+	PhaseSNI       Phase = "sni"
+)
+
+type EventType int
+
+const (
+	EventPhaseStart EventType = iota
+	EventPhaseEnd
+	EventProbe
+	EventIPDone
+	EventBytes
+	EventXrayStart
+)
+
+// Event describes a single step of a running scan. Only the fields that
+// make sense for Type are set.
+type Event struct {
+	Type    EventType
+	Phase   Phase
+	Total   int
+	IP      *net.IPAddr
+	Latency time.Duration
+	Err     error
+	Result  *IPResult
+	Bytes   int64
+}
+
+var (
+	observersMu  sync.RWMutex
+	observers    = make(map[int]func(Event))
+	nextObserver int
+)
+
+// Subscribe registers fn to be called for every scan event and returns a
+// function that removes it again. fn is called from probe goroutines and
+// must not block.
+func Subscribe(fn func(Event)) func() {
+	observersMu.Lock()
+	id := nextObserver
+	nextObserver++
+	observers[id] = fn
+	observersMu.Unlock()
+
+	return func() {
+		observersMu.Lock()
+		delete(observers, id)
+		observersMu.Unlock()
+	}
+}
+
+func emit(e Event) {
+	observersMu.RLock()
+	defer observersMu.RUnlock()
+	for _, fn := range observers {
+		fn(e)
+	}
+}
+
+type countingReader struct {
+	r     io.Reader
+	phase Phase
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if n > 0 {
+		emit(Event{Type: EventBytes, Phase: c.phase, Bytes: int64(n)})
+	}
+	return n, err
+}
+
+func emitPhaseStart(p Phase, total int) {
+	resetFailures(p)
+	emit(Event{Type: EventPhaseStart, Phase: p, Total: total})
+}
+
+func emitPhaseEnd(p Phase) {
+	emit(Event{Type: EventPhaseEnd, Phase: p})
+}
+
+func emitProbe(p Phase, ip *net.IPAddr, latency time.Duration, err error) {
+	recordFailure(p, err)
+	emit(Event{Type: EventProbe, Phase: p, IP: ip, Latency: latency, Err: err})
+}
+
+// emitIPDone reports that testing of ip in phase p has finished. result is
+// nil when the IP failed.
+func emitIPDone(p Phase, ip *net.IPAddr, result *IPResult) {
+	emit(Event{Type: EventIPDone, Phase: p, IP: ip, Result: result})
+}
+
+// emitXrayStart reports an attempt to launch the Xray core; err is nil if
+// it started.
+func emitXrayStart(p Phase, ip *net.IPAddr, err error) {
+	recordFailure(p, failWith(FailureXrayStart, err))
+	emit(Event{Type: EventXrayStart, Phase: p, IP: ip, Err: err})
+}
\ No newline at end of file
@@ -0,0 +1,254 @@
+package scanner
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/fatih/color"
+	utls "github.com/refraction-networking/utls"
+)
+
+// Failure is the reason a single probe attempt failed.
+type Failure string
+
+const (
+	FailureDNS            Failure = "dns"
+	FailureConnectTimeout Failure = "connect timeout"
+	FailureRefused        Failure = "refused"
+	FailureUnreachable    Failure = "unreachable"
+	FailureReset          Failure = "reset"
+	FailureTLS            Failure = "tls"
+	FailureHTTPStatus     Failure = "http status"
+	FailureContent        Failure = "content mismatch"
+	FailureXrayStart      Failure = "xray start"
+	FailureSOCKS          Failure = "socks"
+	FailureReadTimeout    Failure = "read timeout"
+	FailureOther          Failure = "other"
+)
+
+// Hint says what a failure usually points at: the network between the
+// scanner and Cloudflare, or the local setup.
+func (f Failure) Hint() string {
+	switch f {
+	case FailureConnectTimeout, FailureReset, FailureUnreachable:
+		return "likely filtered by the network"
+	case FailureTLS:
+		return "TLS interference or a wrong SNI"
+	case FailureReadTimeout:
+		return "throttled or stalled connection"
+	case FailureHTTPStatus:
+		return "reached a server that rejected the request"
+	case FailureContent:
+		return "reached a server that answered with something else"
+	case FailureXrayStart, FailureSOCKS:
+		return "local Xray setup, check with the validate command"
+	case FailureDNS:
+		return "name resolution, check the DNS settings"
+	case FailureRefused:
+		return "nothing listening on the port"
+	}
+	return ""
+}
+
+// probeError tags err with the failure it stands for when that is known
+// at the point where it happened and cannot be told from err alone.
+type probeError struct {
+	kind Failure
+	err  error
+}
+
+func (e *probeError) Error() string {
+	return string(e.kind) + ": " + e.err.Error()
+}
+
+func (e *probeError) Unwrap() error {
+	return e.err
+}
+
+func failWith(kind Failure, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &probeError{kind: kind, err: err}
+}
+
+// statusError reports an HTTP response with an unexpected status code.
+func statusError(code int) error {
+	return failWith(FailureHTTPStatus, fmt.Errorf("unexpected status %d", code))
+}
+
+// handshakeError tags an error of a TLS handshake as a TLS failure,
+// unless the connection underneath failed in a way ClassifyError already
+// tells apart.
+func handshakeError(err error) error {
+	switch ClassifyError(err) {
+	case FailureReset, FailureRefused, FailureUnreachable:
+		return err
+	}
+	return failWith(FailureTLS, err)
+}
+
+// isTLSError reports whether err was raised by crypto/tls or uTLS. Both
+// report alerts, sent or received, as a net.OpError whose Op says which
+// side raised it.
+func isTLSError(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && (opErr.Op == "local error" || opErr.Op == "remote error") {
+		return true
+	}
+	var recordErr tls.RecordHeaderError
+	var uRecordErr utls.RecordHeaderError
+	var alertErr tls.AlertError
+	var uAlertErr utls.AlertError
+	var verifyErr *tls.CertificateVerificationError
+	var uVerifyErr *utls.CertificateVerificationError
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	return errors.As(err, &recordErr) || errors.As(err, &uRecordErr) ||
+		errors.As(err, &alertErr) || errors.As(err, &uAlertErr) ||
+		errors.As(err, &verifyErr) || errors.As(err, &uVerifyErr) ||
+		errors.As(err, &unknownAuthority) || errors.As(err, &hostnameErr)
+}
+
+// ClassifyError maps a probe error to the kind of failure behind it.
+func ClassifyError(err error) Failure {
+	var pe *probeError
+	if errors.As(err, &pe) {
+		return pe.kind
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return FailureDNS
+	}
+
+	var opErr *net.OpError
+	hasOp := errors.As(err, &opErr)
+	if hasOp && strings.HasPrefix(opErr.Op, "socks") {
+		// Nothing listening on the local SOCKS port means Xray is not up.
+		if errors.Is(err, syscall.ECONNREFUSED) {
+			return FailureXrayStart
+		}
+		return FailureSOCKS
+	}
+
+	var netErr net.Error
+	switch {
+	case errors.As(err, &netErr) && netErr.Timeout():
+		if hasOp && opErr.Op == "dial" {
+			return FailureConnectTimeout
+		}
+		return FailureReadTimeout
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return FailureRefused
+	case errors.Is(err, syscall.ENETUNREACH), errors.Is(err, syscall.EHOSTUNREACH):
+		return FailureUnreachable
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE),
+		errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return FailureReset
+	case isTLSError(err):
+		return FailureTLS
+	default:
+		return FailureOther
+	}
+}
+
+// FailureCounts counts failed probe attempts by reason.
+type FailureCounts map[Failure]int
+
+func (c FailureCounts) add(err error) FailureCounts {
+	if err == nil {
+		return c
+	}
+	if c == nil {
+		c = make(FailureCounts)
+	}
+	c[ClassifyError(err)]++
+	return c
+}
+
+// Total returns the number of failed attempts.
+func (c FailureCounts) Total() int {
+	total := 0
+	for _, n := range c {
+		total += n
+	}
+	return total
+}
+
+// Sorted returns the reasons, most frequent first.
+func (c FailureCounts) Sorted() []Failure {
+	kinds := make([]Failure, 0, len(c))
+	for k := range c {
+		kinds = append(kinds, k)
+	}
+	sort.Slice(kinds, func(i, j int) bool {
+		if c[kinds[i]] != c[kinds[j]] {
+			return c[kinds[i]] > c[kinds[j]]
+		}
+		return kinds[i] < kinds[j]
+	})
+	return kinds
+}
+
+func (c FailureCounts) String() string {
+	parts := make([]string, 0, len(c))
+	for _, k := range c.Sorted() {
+		parts = append(parts, fmt.Sprintf("%s %d", k, c[k]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// printFailureSummary lists why attempts failed in the last run of phase
+// p, with what each reason usually points at.
+func printFailureSummary(p Phase) {
+	counts := PhaseFailures(p)
+	if counts.Total() == 0 {
+		return
+	}
+	yellow := color.New(color.FgYellow)
+	yellow.Printf("Failed attempts: %d\n", counts.Total())
+	for _, k := range counts.Sorted() {
+		yellow.Printf("  %-16s %7d  %s\n", k, counts[k], k.Hint())
+	}
+	fmt.Fprintln(output)
+}
+
+var phaseFailures = struct {
+	mu     sync.Mutex
+	counts map[Phase]FailureCounts
+}{counts: make(map[Phase]FailureCounts)}
+
+func recordFailure(p Phase, err error) {
+	if err == nil {
+		return
+	}
+	phaseFailures.mu.Lock()
+	phaseFailures.counts[p] = phaseFailures.counts[p].add(err)
+	phaseFailures.mu.Unlock()
+}
+
+func resetFailures(p Phase) {
+	phaseFailures.mu.Lock()
+	delete(phaseFailures.counts, p)
+	phaseFailures.mu.Unlock()
+}
+
+// PhaseFailures returns the failed attempts of the last run of phase p.
+func PhaseFailures(p Phase) FailureCounts {
+	phaseFailures.mu.Lock()
+	defer phaseFailures.mu.Unlock()
+	counts := make(FailureCounts, len(phaseFailures.counts[p]))
+	for k, n := range phaseFailures.counts[p] {
+		counts[k] = n
+	}
+	return counts
+}
\ No newline at end of file
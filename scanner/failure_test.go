@@ -0,0 +1,38 @@
+package scanner
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestClassifyError(t *testing.T) {
+	remoteAlert := &net.OpError{Op: "remote error", Err: errors.New("tls: handshake failure")}
+	for _, tc := range []struct {
+		name string
+		err  error
+		want Failure
+	}{
+		{"status", statusError(403), FailureHTTPStatus},
+		{"content", failWith(FailureContent, errors.New("response does not contain \"ok\"")), FailureContent},
+		{"remote alert", fmt.Errorf("get: %w", remoteAlert), FailureTLS},
+		{"handshake", handshakeError(errors.New("tls: unexpected message")), FailureTLS},
+		{"reset in handshake", handshakeError(&net.OpError{Op: "read", Err: syscall.ECONNRESET}), FailureReset},
+		{"dial timeout", &net.OpError{Op: "dial", Err: timeoutErr{}}, FailureConnectTimeout},
+		{"read timeout", &net.OpError{Op: "read", Err: timeoutErr{}}, FailureReadTimeout},
+		{"unrelated status text", errors.New("bad status line"), FailureOther},
+		{"unrelated tls text", errors.New("tls: looks like TLS"), FailureOther},
+	} {
+		if got := ClassifyError(tc.err); got != tc.want {
+			t.Errorf("%s: ClassifyError(%v) = %q, want %q", tc.name, tc.err, got, tc.want)
+		}
+	}
+}
+
+type timeoutErr struct{}
+
+func (timeoutErr) Error() string   { return "i/o timeout" }
+func (timeoutErr) Timeout() bool   { return true }
+func (timeoutErr) Temporary() bool { return true }
\ No newline at end of file
@@ -0,0 +1,133 @@
+package scanner
+
+import (
+	"context"
+	"crypto/tls"
+	"math/rand"
+	"net"
+	"strings"
+
+	utls "github.com/refraction-networking/utls"
+)
+
+// TLSConfig selects the ClientHello sent by the speed test and the SNI
+// sweep. Fingerprint takes the same names as the fingerprint field of
+// Xray's tlsSettings; when it is empty and FromXrayConfig is set, the one
+// from config/xray_config.json is used. Without either, Go's own TLS
+// stack is used.
+type TLSConfig struct {
+	Fingerprint    string `json:"fingerprint"`
+	FromXrayConfig bool   `json:"from_xray_config"`
+}
+
+func DefaultTLSConfig() TLSConfig {
+	return TLSConfig{FromXrayConfig: true}
+}
+
+var helloIDs = map[string]utls.ClientHelloID{
+	"chrome":     utls.HelloChrome_Auto,
+	"firefox":    utls.HelloFirefox_Auto,
+	"safari":     utls.HelloSafari_Auto,
+	"ios":        utls.HelloIOS_Auto,
+	"android":    utls.HelloAndroid_11_OkHttp,
+	"edge":       utls.HelloEdge_Auto,
+	"360":        utls.Hello360_Auto,
+	"qq":         utls.HelloQQ_Auto,
+	"randomized": utls.HelloRandomizedNoALPN,
+}
+
+// "random" picks one of these once, like Xray does at startup.
+var randomChoices = []string{"chrome", "firefox", "safari", "ios", "edge"}
+
+// KnownFingerprint reports whether name is a fingerprint the scanner can
+// imitate. "go" selects Go's own TLS stack explicitly.
+func KnownFingerprint(name string) bool {
+	name = strings.ToLower(name)
+	_, ok := helloIDs[name]
+	return ok || name == "random" || name == "go"
+}
+
+var (
+	fingerprintName string
+	helloID         *utls.ClientHelloID
+)
+
+func configFingerprint() string {
+	cfg, err := readXrayConfig()
+	if err != nil {
+		return ""
+	}
+	proxyOutbound, _, err := findProxyOutbound(cfg)
+	if err != nil {
+		return ""
+	}
+	return streamParams(proxyOutbound).Get("fp")
+}
+
+func configureFingerprint(c TLSConfig) {
+	fingerprintName, helloID = "", nil
+
+	name := strings.ToLower(strings.TrimSpace(c.Fingerprint))
+	if name == "" && c.FromXrayConfig {
+		name = strings.ToLower(configFingerprint())
+	}
+	if name == "random" {
+		name = randomChoices[rand.Intn(len(randomChoices))]
+	}
+	id, ok := helloIDs[name]
+	if !ok {
+		return
+	}
+	fingerprintName, helloID = name, &id
+}
+
+// Fingerprint returns the browser fingerprint TLS probes imitate, or ""
+// when Go's own ClientHello is sent.
+func Fingerprint() string {
+	return fingerprintName
+}
+
+// tlsHandshake runs a TLS handshake over conn with the configured
+// fingerprint. ALPN only offers http/1.1 because the probes speak nothing
+// else; Xray does the same for WebSocket transports.
+func tlsHandshake(ctx context.Context, conn net.Conn, serverName string, insecure bool) (net.Conn, error) {
+	if helloID == nil {
+		c := tls.Client(conn, &tls.Config{
+			ServerName:         serverName,
+			InsecureSkipVerify: insecure,
+			NextProtos:         []string{"http/1.1"},
+		})
+		if err := c.HandshakeContext(ctx); err != nil {
+			return nil, handshakeError(err)
+		}
+		return c, nil
+	}
+
+	config := &utls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: insecure,
+		NextProtos:         []string{"http/1.1"},
+	}
+	var uconn *utls.UConn
+	if helloID.Client == utls.HelloRandomizedNoALPN.Client {
+		uconn = utls.UClient(conn, config, *helloID)
+	} else {
+		spec, err := utls.UTLSIdToSpec(*helloID)
+		if err != nil {
+			return nil, err
+		}
+		for _, ext := range spec.Extensions {
+			if alpn, ok := ext.(*utls.ALPNExtension); ok {
+				alpn.AlpnProtocols = []string{"http/1.1"}
+			}
+		}
+		uconn = utls.UClient(conn, config, utls.HelloCustom)
+		if err := uconn.ApplyPreset(&spec); err != nil {
+			return nil, err
+		}
+	}
+	if err := uconn.HandshakeContext(ctx); err != nil {
+		return nil, handshakeError(err)
+	}
+	return uconn, nil
+}
\ No newline at end of file
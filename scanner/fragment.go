@@ -0,0 +1,331 @@
+package scanner
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const fragmentTag = "fragment"
+
+// FragmentConfig is the grid searched by the fragment sweep. Every
+// combination of Packets, Lengths and Intervals is tried on the TopIPs
+// best responsive IPs; the SpeedTop best combinations are then speed
+// tested.
+type FragmentConfig struct {
+	Packets   []string `json:"packets"`
+	Lengths   []string `json:"lengths"`
+	Intervals []string `json:"intervals"`
+	TopIPs    int      `json:"top_ips"`
+	SpeedTop  int      `json:"speed_top"`
+	Workers   int      `json:"workers"`
+}
+
+func DefaultFragmentConfig() FragmentConfig {
+	return FragmentConfig{
+		Packets:   []string{"tlshello", "1-3"},
+		Lengths:   []string{"10-20", "50-100", "100-200"},
+		Intervals: []string{"1-3", "5-10", "10-20"},
+		TopIPs:    5,
+		SpeedTop:  3,
+		Workers:   4,
+	}
+}
+
+// Fragment is one set of fragment settings of Xray's freedom outbound.
+type Fragment struct {
+	Packets  string `json:"packets"`
+	Length   string `json:"length"`
+	Interval string `json:"interval"`
+}
+
+func (f Fragment) String() string {
+	return "packets=" + f.Packets + " length=" + f.Length + " interval=" + f.Interval
+}
+
+func (f Fragment) settings() map[string]interface{} {
+	return map[string]interface{}{
+		"packets":  f.Packets,
+		"length":   f.Length,
+		"interval": f.Interval,
+	}
+}
+
+// FragmentResult sums up one combination over all tested IPs. Attempts
+// counts every round of every IP, also those skipped once an IP was
+// dropped, so each IP weighs the same in SuccessRate. Speed is in bytes per
+// second and only set for combinations that were speed tested;
+// SpeedFailure says why the speed test of a combination failed.
+type FragmentResult struct {
+	Fragment     Fragment
+	Attempts     int
+	Succeeded    int
+	Latency      time.Duration
+	BestIP       *net.IPAddr
+	Speed        float64
+	SpeedFailure Failure
+	samples      []time.Duration
+	bestDelay    time.Duration
+}
+
+// SuccessRate returns the share of probes that got through, from 0 to 1.
+func (r FragmentResult) SuccessRate() float64 {
+	if r.Attempts == 0 {
+		return 0
+	}
+	return float64(r.Succeeded) / float64(r.Attempts)
+}
+
+// FragmentGrid returns every combination of c in a stable order.
+func FragmentGrid(c FragmentConfig) []Fragment {
+	var grid []Fragment
+	for _, p := range c.Packets {
+		for _, l := range c.Lengths {
+			for _, i := range c.Intervals {
+				grid = append(grid, Fragment{Packets: p, Length: l, Interval: i})
+			}
+		}
+	}
+	return grid
+}
+
+// fragmentDialer follows the dialer chain of proxy through byTag to the
+// last outbound that is not freedom, the one whose connections reach the
+// network and so have to be fragmented. It returns that outbound, its tag,
+// "" for proxy itself, and the tag of the freedom outbound it already
+// dials through, if any.
+func fragmentDialer(proxy map[string]interface{}, byTag map[string]map[string]interface{}) (dialer map[string]interface{}, dialerTag, freedomTag string, err error) {
+	dialer = proxy
+	seen := map[string]bool{}
+	for {
+		tags := chainedTags(dialer)
+		if len(tags) == 0 {
+			return dialer, dialerTag, "", nil
+		}
+		next := tags[0][0]
+		out, ok := byTag[next]
+		if !ok {
+			return nil, "", "", fmt.Errorf("outbound %q used by %s is not in the config", next, tags[0][1])
+		}
+		if protocol, _ := out["protocol"].(string); strings.ToLower(protocol) == "freedom" {
+			return dialer, dialerTag, next, nil
+		}
+		if seen[next] {
+			return nil, "", "", fmt.Errorf("the outbounds chained to the proxy loop back to %q", next)
+		}
+		seen[next] = true
+		dialer, dialerTag = out, next
+	}
+}
+
+// withFragment makes the connections of proxy leave through a freedom
+// outbound with the given fragment settings. When proxy is chained, the
+// last outbound of the chain is the one that dials through it. A freedom
+// outbound already at the end of the chain is reused; otherwise a new one
+// is added.
+func withFragment(proxy map[string]interface{}, outbounds []interface{}, fragment map[string]interface{}) ([]interface{}, error) {
+	byTag := make(map[string]map[string]interface{})
+	for _, o := range outbounds {
+		if out, ok := o.(map[string]interface{}); ok {
+			if tag := stringField(out, "tag"); tag != "" {
+				byTag[tag] = out
+			}
+		}
+	}
+	dialer, _, freedomTag, err := fragmentDialer(proxy, byTag)
+	if err != nil {
+		return nil, err
+	}
+	if freedomTag != "" {
+		out := byTag[freedomTag]
+		settings, ok := out["settings"].(map[string]interface{})
+		if !ok {
+			settings = make(map[string]interface{})
+			out["settings"] = settings
+		}
+		settings["fragment"] = fragment
+		return outbounds, nil
+	}
+
+	ss, ok := dialer["streamSettings"].(map[string]interface{})
+	if !ok {
+		ss = make(map[string]interface{})
+		dialer["streamSettings"] = ss
+	}
+	sockopt, ok := ss["sockopt"].(map[string]interface{})
+	if !ok {
+		sockopt = make(map[string]interface{})
+		ss["sockopt"] = sockopt
+	}
+	sockopt["dialerProxy"] = fragmentTag
+
+	return append(outbounds, map[string]interface{}{
+		"protocol": "freedom",
+		"tag":      fragmentTag,
+		"settings": map[string]interface{}{"fragment": fragment},
+	}), nil
+}
+
+// FragmentOutbound returns the freedom outbound for f, ready to paste into
+// the outbounds of config/xray_config.json, its tag and the outbound that
+// has to dial through it: the proxy, or the last outbound the proxy is
+// chained to. It keeps the tag of an existing fragment outbound so no
+// dialerProxy needs to change.
+func FragmentOutbound(f Fragment) (block []byte, tag, dialer string) {
+	tag, dialer = fragmentTag, "the proxy"
+	if cfg, err := readXrayConfig(); err == nil {
+		if proxyOutbound, byTag, err := findProxyOutbound(cfg); err == nil {
+			if _, dialerTag, freedomTag, err := fragmentDialer(proxyOutbound, byTag); err == nil {
+				if freedomTag != "" {
+					tag = freedomTag
+				}
+				if dialerTag != "" {
+					dialer = fmt.Sprintf("outbound %q", dialerTag)
+				}
+			}
+		}
+	}
+	out := map[string]interface{}{
+		"tag":      tag,
+		"protocol": "freedom",
+		"settings": map[string]interface{}{"fragment": f.settings()},
+	}
+	block, _ = json.MarshalIndent(out, "", "  ")
+	return block, tag, dialer
+}
+
+// SweepFragments tries every combination of FragmentGrid(c) through Xray
+// on each of ips and speed tests the best ones. Results are sorted best
+// first: by success rate, then speed, then latency.
+func SweepFragments(stopCh <-chan struct{}, ips []*net.IPAddr, c FragmentConfig) []FragmentResult {
+	grid := FragmentGrid(c)
+	results := make([]FragmentResult, len(grid))
+	for i, f := range grid {
+		results[i].Fragment = f
+	}
+
+	type job struct {
+		combo int
+		ip    *net.IPAddr
+	}
+	jobs := make(chan job)
+	workers := c.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	if workers > xrayWorkerCount {
+		workers = xrayWorkerCount
+	}
+
+	total := len(grid) * len(ips)
+	bar := newBar(total, "Working:", "")
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	working := 0
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(socksPort int) {
+			defer wg.Done()
+			for j := range jobs {
+				_, samples, _ := testIPViaXray(j.ip, socksPort, grid[j.combo].settings())
+				mu.Lock()
+				r := &results[j.combo]
+				r.Attempts += opts.Ping.XrayRounds.rounds()
+				r.Succeeded += len(samples)
+				r.samples = append(r.samples, samples...)
+				if len(samples) > 0 {
+					working++
+					avg := averageDuration(samples)
+					if r.BestIP == nil || avg < r.bestDelay {
+						r.BestIP, r.bestDelay = j.ip, avg
+					}
+				}
+				count := working
+				mu.Unlock()
+				bar.grow(1, strconv.Itoa(count))
+			}
+		}(xrayPortBase + w)
+	}
+
+feed:
+	for k := range grid {
+		for _, ip := range ips {
+			select {
+			case <-stopCh:
+				break feed
+			case jobs <- job{combo: k, ip: ip}:
+			}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	bar.done()
+
+	for i := range results {
+		if len(results[i].samples) > 0 {
+			results[i].Latency = averageDuration(results[i].samples)
+		}
+	}
+	sortFragmentResults(results)
+
+	speedPort := xrayPortBase + xrayWorkerCount
+	for i := 0; i < len(results) && i < c.SpeedTop; i++ {
+		select {
+		case <-stopCh:
+			sortFragmentResults(results)
+			return results
+		default:
+		}
+		r := &results[i]
+		if r.BestIP == nil {
+			break
+		}
+		ctx, cancel := skippableContext()
+		t, err := downloadSpeedViaXray(ctx, r.BestIP, speedPort, r.Fragment.settings())
+		skipped := ctx.Err() != nil
+		cancel()
+		if skipped {
+			continue
+		}
+		// Start failures were already reported by emitXrayStart.
+		if err == nil || ClassifyError(err) != FailureXrayStart {
+			emitProbe(PhaseXraySpeed, r.BestIP, 0, err)
+		}
+		if err != nil {
+			r.SpeedFailure = ClassifyError(err)
+			continue
+		}
+		r.Speed = t.Mean
+	}
+	sortFragmentResults(results)
+	return results
+}
+
+func averageDuration(samples []time.Duration) time.Duration {
+	var sum time.Duration
+	for _, d := range samples {
+		sum += d
+	}
+	return sum / time.Duration(len(samples))
+}
+
+func sortFragmentResults(results []FragmentResult) {
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.SuccessRate() != b.SuccessRate() {
+			return a.SuccessRate() > b.SuccessRate()
+		}
+		if a.Speed != b.Speed {
+			return a.Speed > b.Speed
+		}
+		if a.Latency == 0 || b.Latency == 0 {
+			return b.Latency == 0 && a.Latency != 0
+		}
+		return a.Latency < b.Latency
+	})
+}
\ No newline at end of file
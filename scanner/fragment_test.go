@@ -0,0 +1,111 @@
+package scanner
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func outbound(tag, protocol, dialerProxy string) map[string]interface{} {
+	out := map[string]interface{}{"tag": tag, "protocol": protocol}
+	if dialerProxy != "" {
+		out["streamSettings"] = map[string]interface{}{
+			"sockopt": map[string]interface{}{"dialerProxy": dialerProxy},
+		}
+	}
+	return out
+}
+
+func outboundList(outs ...map[string]interface{}) []interface{} {
+	list := make([]interface{}, len(outs))
+	for i, o := range outs {
+		list[i] = o
+	}
+	return list
+}
+
+func fragmentOf(out map[string]interface{}) interface{} {
+	settings, _ := out["settings"].(map[string]interface{})
+	return settings["fragment"]
+}
+
+var testFragment = Fragment{Packets: "tlshello", Length: "100-200", Interval: "10-20"}.settings()
+
+func TestWithFragmentAddsOutbound(t *testing.T) {
+	proxy := outbound("proxy", "vless", "")
+	got, err := withFragment(proxy, outboundList(proxy), testFragment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if getDialerProxy(proxy) != fragmentTag {
+		t.Errorf("proxy dials through %q", getDialerProxy(proxy))
+	}
+	if len(got) != 2 || !reflect.DeepEqual(fragmentOf(got[1].(map[string]interface{})), testFragment) {
+		t.Errorf("outbounds = %v", got)
+	}
+}
+
+func TestWithFragmentReusesFreedomDialer(t *testing.T) {
+	proxy := outbound("proxy", "vless", "frag")
+	frag := outbound("frag", "freedom", "")
+	got, err := withFragment(proxy, outboundList(proxy, frag), testFragment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || getDialerProxy(proxy) != "frag" {
+		t.Errorf("outbounds = %v", got)
+	}
+	if !reflect.DeepEqual(fragmentOf(frag), testFragment) {
+		t.Errorf("freedom dialer settings = %v", frag["settings"])
+	}
+}
+
+func TestWithFragmentKeepsChain(t *testing.T) {
+	proxy := outbound("proxy", "vless", "hop1")
+	hop1 := outbound("hop1", "vmess", "")
+	hop1["proxySettings"] = map[string]interface{}{"tag": "hop2"}
+	hop2 := outbound("hop2", "trojan", "")
+	got, err := withFragment(proxy, outboundList(proxy, hop1, hop2), testFragment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if getDialerProxy(proxy) != "hop1" || getDialerProxy(hop1) != "" {
+		t.Errorf("chain changed: proxy -> %q, hop1 -> %q", getDialerProxy(proxy), getDialerProxy(hop1))
+	}
+	if getDialerProxy(hop2) != fragmentTag {
+		t.Errorf("last hop dials through %q, want %q", getDialerProxy(hop2), fragmentTag)
+	}
+	if len(got) != 4 || !reflect.DeepEqual(fragmentOf(got[3].(map[string]interface{})), testFragment) {
+		t.Errorf("outbounds = %v", got)
+	}
+}
+
+func TestWithFragmentReusesFreedomAtChainEnd(t *testing.T) {
+	proxy := outbound("proxy", "vless", "hop")
+	hop := outbound("hop", "vmess", "frag")
+	frag := outbound("frag", "freedom", "")
+	got, err := withFragment(proxy, outboundList(proxy, hop, frag), testFragment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || getDialerProxy(proxy) != "hop" || getDialerProxy(hop) != "frag" {
+		t.Errorf("outbounds = %v", got)
+	}
+	if !reflect.DeepEqual(fragmentOf(frag), testFragment) {
+		t.Errorf("freedom dialer settings = %v", frag["settings"])
+	}
+}
+
+func TestWithFragmentBrokenChain(t *testing.T) {
+	proxy := outbound("proxy", "vless", "missing")
+	if _, err := withFragment(proxy, outboundList(proxy), testFragment); err == nil || !strings.Contains(err.Error(), `"missing"`) {
+		t.Errorf("missing hop: err = %v", err)
+	}
+
+	proxy = outbound("proxy", "vless", "a")
+	a := outbound("a", "vmess", "b")
+	b := outbound("b", "vmess", "a")
+	if _, err := withFragment(proxy, outboundList(proxy, a, b), testFragment); err == nil || !strings.Contains(err.Error(), "loop") {
+		t.Errorf("loop: err = %v", err)
+	}
+}
\ No newline at end of file
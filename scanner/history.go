@@ -0,0 +1,119 @@
+package scanner
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+const historyMaxAge = 30 * 24 * time.Hour
+
+type historyEntry struct {
+	Runs     int       `json:"runs"`
+	Sent     int       `json:"sent"`
+	Received int       `json:"received"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// History keeps per-IP probe counts across runs so that IPs which were
+// flaky in earlier scans can be ranked below consistently good ones.
+type History struct {
+	path    string
+	entries map[string]*historyEntry
+}
+
+func LoadHistory(path string) *History {
+	h := &History{path: path, entries: make(map[string]*historyEntry)}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return h
+	}
+	if err := json.Unmarshal(data, &h.entries); err != nil {
+		h.entries = make(map[string]*historyEntry)
+	}
+	return h
+}
+
+// Stability returns the historical success ratio of ip, or false if it has
+// never been seen before.
+func (h *History) Stability(ip string) (float64, bool) {
+	e, ok := h.entries[ip]
+	if !ok || e.Sent == 0 {
+		return 0, false
+	}
+	return float64(e.Received) / float64(e.Sent), true
+}
+
+// Apply sets the Stability of each result from previous runs. IPs without
+// history keep their current value.
+func (h *History) Apply(results []IPResult) {
+	for i := range results {
+		if s, ok := h.Stability(results[i].IP.String()); ok {
+			results[i].Stability = s
+		}
+	}
+}
+
+// probeTally counts the latency probes of one run per IP as the probe
+// events come in. Unlike the ping results it also holds the IPs that never
+// answered or were dropped by the filters.
+type probeTally struct {
+	mu     sync.Mutex
+	counts map[string]*historyEntry
+}
+
+func newProbeTally() *probeTally {
+	return &probeTally{counts: make(map[string]*historyEntry)}
+}
+
+func (t *probeTally) observe(e Event) {
+	if e.Type != EventProbe || (e.Phase != PhasePing && e.Phase != PhaseXrayPing) {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := e.IP.String()
+	c, ok := t.counts[key]
+	if !ok {
+		c = &historyEntry{}
+		t.counts[key] = c
+	}
+	c.Sent++
+	if e.Err == nil {
+		c.Received++
+	}
+}
+
+// Record adds the probes of one run to the history, those of IPs that did
+// not answer included.
+func (h *History) Record(t *probeTally) {
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for key, c := range t.counts {
+		e, ok := h.entries[key]
+		if !ok {
+			e = &historyEntry{}
+			h.entries[key] = e
+		}
+		e.Runs++
+		e.Sent += c.Sent
+		e.Received += c.Received
+		e.LastSeen = now
+	}
+}
+
+func (h *History) Save() error {
+	cutoff := time.Now().Add(-historyMaxAge)
+	for ip, e := range h.entries {
+		if e.LastSeen.Before(cutoff) {
+			delete(h.entries, ip)
+		}
+	}
+	data, err := json.Marshal(h.entries)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(h.path, data, 0644)
+}
\ No newline at end of file
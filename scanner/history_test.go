@@ -0,0 +1,32 @@
+package scanner
+
+import (
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+func TestHistoryRecordsDeadIPs(t *testing.T) {
+	alive := &net.IPAddr{IP: net.ParseIP("1.1.1.1")}
+	dead := &net.IPAddr{IP: net.ParseIP("2.2.2.2")}
+
+	tally := newProbeTally()
+	tally.observe(Event{Type: EventProbe, Phase: PhasePing, IP: alive})
+	tally.observe(Event{Type: EventProbe, Phase: PhasePing, IP: alive, Err: errors.New("lost")})
+	tally.observe(Event{Type: EventProbe, Phase: PhasePing, IP: dead, Err: errors.New("timeout")})
+	tally.observe(Event{Type: EventProbe, Phase: PhaseSpeed, IP: dead, Err: errors.New("reset")})
+
+	h := LoadHistory(filepath.Join(t.TempDir(), "history.json"))
+	h.Record(tally)
+
+	if s, ok := h.Stability(alive.String()); !ok || s != 0.5 {
+		t.Errorf("alive: stability %v, %v, want 0.5", s, ok)
+	}
+	if s, ok := h.Stability(dead.String()); !ok || s != 0 {
+		t.Errorf("dead: stability %v, %v, want 0", s, ok)
+	}
+	if e := h.entries[dead.String()]; e.Sent != 1 || e.Runs != 1 {
+		t.Errorf("dead: %+v, want one probe in one run", e)
+	}
+}
\ No newline at end of file
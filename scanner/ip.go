@@ -31,7 +31,7 @@ func (r *IPRanges) expandCIDR(cidr string) {
 
 	_, ipNet, err := net.ParseCIDR(cidr)
 	if err != nil {
-		fmt.Printf("ParseCIDR error for %s: %v\n", cidr, err)
+		fmt.Fprintf(output, "ParseCIDR error for %s: %v\n", cidr, err)
 		return
 	}
 
@@ -91,4 +91,67 @@ func GenerateIPs(ranges []string) []*net.IPAddr {
 	})
 
 	return ipRanges.ips
+}
+
+// SampleIPs picks up to n distinct random addresses from ranges without
+// expanding them, so large ranges can be probed partially. Ranges are
+// chosen with a weight proportional to their size, capped so that a single
+// IPv6 block does not take every sample.
+func SampleIPs(ranges []string, n int) []*net.IPAddr {
+	var nets []*net.IPNet
+	var weights []float64
+	var totalWeight float64
+
+	for _, r := range ranges {
+		r = strings.TrimSpace(r)
+		if r == "" {
+			continue
+		}
+		if !strings.Contains(r, "/") {
+			if isIPv4(r) {
+				r += "/32"
+			} else {
+				r += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(r)
+		if err != nil {
+			continue
+		}
+		ones, bits := ipNet.Mask.Size()
+		hostBits := bits - ones
+		if hostBits > 24 {
+			hostBits = 24
+		}
+		w := float64(uint64(1) << uint(hostBits))
+		nets = append(nets, ipNet)
+		weights = append(weights, w)
+		totalWeight += w
+	}
+	if len(nets) == 0 {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	var ips []*net.IPAddr
+	for attempts := 0; len(ips) < n && attempts < n*4; attempts++ {
+		pick := rand.Float64() * totalWeight
+		idx := 0
+		for idx < len(weights)-1 && pick >= weights[idx] {
+			pick -= weights[idx]
+			idx++
+		}
+		ipNet := nets[idx]
+
+		ip := cloneIP(ipNet.IP)
+		for i := range ip {
+			ip[i] |= byte(rand.Intn(256)) &^ ipNet.Mask[i]
+		}
+		if seen[ip.String()] {
+			continue
+		}
+		seen[ip.String()] = true
+		ips = append(ips, &net.IPAddr{IP: ip})
+	}
+	return ips
 }
\ No newline at end of file
@@ -0,0 +1,54 @@
+package scanner
+
+// Options holds the user-tunable scanner settings. The zero value is not
+// useful; start from DefaultOptions and override individual fields.
+type Options struct {
+	Scoring   ScoreConfig     `json:"scoring"`
+	Ping      PingConfig      `json:"ping"`
+	RateLimit RateLimitConfig `json:"rate_limit"`
+	Apply     ApplyConfig     `json:"apply"`
+	SNI       SNIConfig       `json:"sni"`
+	TLS       TLSConfig       `json:"tls"`
+	Fragment  FragmentConfig  `json:"fragment"`
+	Probe     ProbeConfig     `json:"probe"`
+	Speed     SpeedConfig     `json:"speed"`
+}
+
+type PingConfig struct {
+	Concurrency ConcurrencyConfig `json:"concurrency"`
+	Rounds      ProbeRounds       `json:"rounds"`
+	XrayRounds  ProbeRounds       `json:"xray_rounds"`
+}
+
+var opts = DefaultOptions()
+
+func DefaultOptions() Options {
+	return Options{
+		Scoring: DefaultScoreConfig(),
+		Ping: PingConfig{
+			Concurrency: DefaultConcurrencyConfig(),
+			Rounds:      DefaultTCPRounds(),
+			XrayRounds:  DefaultXrayRounds(),
+		},
+		RateLimit: RateLimitConfig{
+			Burst: 10,
+		},
+		Apply:    DefaultApplyConfig(),
+		SNI:      DefaultSNIConfig(),
+		TLS:      DefaultTLSConfig(),
+		Fragment: DefaultFragmentConfig(),
+		Probe:    DefaultProbeConfig(),
+		Speed:    DefaultSpeedConfig(),
+	}
+}
+
+// Configure replaces the settings used by all subsequent scans.
+func Configure(o Options) {
+	opts = o
+	limiters = newRateLimiters(o.RateLimit)
+	configureFingerprint(o.TLS)
+}
+
+func CurrentOptions() Options {
+	return opts
+}
\ No newline at end of file
@@ -0,0 +1,216 @@
+package scanner
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// preservedOutboundFields are copied unchanged from the user's outbounds
+// into the test config, next to protocol, tag, settings and
+// streamSettings.
+var preservedOutboundFields = []string{"sendThrough", "proxySettings", "targetStrategy"}
+
+// serverEntry returns the map holding the address of outbound's first
+// server and a name for it used in change reports. Newer Xray versions
+// also accept the address directly in settings.
+func serverEntry(protocol string, settings map[string]interface{}) (map[string]interface{}, string, error) {
+	if _, ok := settings["address"]; ok {
+		return settings, "settings", nil
+	}
+
+	var key string
+	switch protocol {
+	case "vless", "vmess":
+		key = "vnext"
+	case "trojan", "shadowsocks", "http", "socks":
+		key = "servers"
+	case "hysteria":
+		return nil, "", fmt.Errorf("hysteria outbound missing 'address'")
+	default:
+		return nil, "", fmt.Errorf("unsupported proxy protocol: %s", protocol)
+	}
+
+	raw, ok := settings[key]
+	if !ok {
+		return nil, "", fmt.Errorf("%s outbound missing '%s'", protocol, key)
+	}
+	list, ok := raw.([]interface{})
+	if !ok || len(list) == 0 {
+		return nil, "", fmt.Errorf("%s '%s' is empty", protocol, key)
+	}
+	server, ok := list[0].(map[string]interface{})
+	if !ok {
+		return nil, "", fmt.Errorf("%s server entry is invalid", protocol)
+	}
+	return server, key + "[0]", nil
+}
+
+// setOutboundAddress points the first server of outbound at ip:port and
+// returns a description of every field it changed. WireGuard peers keep
+// their own port. When the old address was a domain name it is kept as
+// the TLS server name and Host header where those are not set, since the
+// server would otherwise see the bare IP.
+func setOutboundAddress(outbound map[string]interface{}, ip string, port int) ([]string, error) {
+	protocol, _ := outbound["protocol"].(string)
+	protocol = strings.ToLower(protocol)
+
+	settings, ok := outbound["settings"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("proxy outbound has no 'settings' field")
+	}
+
+	var changes []string
+	var oldHost string
+	if protocol == "wireguard" {
+		peers, ok := settings["peers"].([]interface{})
+		if !ok || len(peers) == 0 {
+			return nil, fmt.Errorf("wireguard outbound has no 'peers'")
+		}
+		for i, p := range peers {
+			peer, ok := p.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("wireguard peer entry is invalid")
+			}
+			endpoint := stringField(peer, "endpoint")
+			host, peerPort, err := net.SplitHostPort(endpoint)
+			if err != nil {
+				return nil, fmt.Errorf("wireguard peer endpoint %q: %v", endpoint, err)
+			}
+			peer["endpoint"] = net.JoinHostPort(ip, peerPort)
+			changes = append(changes, fmt.Sprintf("peers[%d].endpoint: %s -> %s", i, endpoint, peer["endpoint"]))
+			if i == 0 {
+				oldHost = host
+			}
+		}
+	} else {
+		server, name, err := serverEntry(protocol, settings)
+		if err != nil {
+			return nil, err
+		}
+		oldHost = stringField(server, "address")
+		server["address"] = ip
+		changes = append(changes, fmt.Sprintf("%s.address: %s -> %s", name, oldHost, ip))
+
+		oldPort, _ := server["port"].(float64)
+		server["port"] = float64(port)
+		if int(oldPort) != port {
+			changes = append(changes, fmt.Sprintf("%s.port: %d -> %d", name, int(oldPort), port))
+		}
+	}
+
+	if oldHost != "" && net.ParseIP(oldHost) == nil {
+		changes = append(changes, keepServerName(outbound, oldHost)...)
+	}
+	return changes, nil
+}
+
+// keepServerName fills in the TLS server name and the transport's Host
+// header with domain where they are empty.
+func keepServerName(outbound map[string]interface{}, domain string) []string {
+	ss, ok := outbound["streamSettings"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	var changes []string
+
+	if stringField(ss, "security") == "tls" {
+		tlsSettings, ok := ss["tlsSettings"].(map[string]interface{})
+		if !ok {
+			tlsSettings = make(map[string]interface{})
+			ss["tlsSettings"] = tlsSettings
+		}
+		if stringField(tlsSettings, "serverName") == "" {
+			tlsSettings["serverName"] = domain
+			changes = append(changes, "tlsSettings.serverName: set to "+domain+", the original address")
+		}
+	}
+
+	var key string
+	switch stringField(ss, "network") {
+	case "ws":
+		key = "wsSettings"
+	case "httpupgrade":
+		key = "httpupgradeSettings"
+	case "splithttp", "xhttp":
+		key = stringField(ss, "network") + "Settings"
+	default:
+		return changes
+	}
+	transport, ok := ss[key].(map[string]interface{})
+	if !ok {
+		transport = make(map[string]interface{})
+		ss[key] = transport
+	}
+	headers, _ := transport["headers"].(map[string]interface{})
+	if stringField(transport, "host") == "" && stringField(headers, "Host") == "" {
+		transport["host"] = domain
+		changes = append(changes, key+".host: set to "+domain+", the original address")
+	}
+	return changes
+}
+
+// cleanOutbound copies the fields of out that the test config needs and
+// reports the ones it leaves behind.
+func cleanOutbound(out map[string]interface{}, tag string) (map[string]interface{}, []string) {
+	clean := map[string]interface{}{
+		"protocol": out["protocol"],
+		"tag":      tag,
+	}
+	if settings, ok := out["settings"].(map[string]interface{}); ok {
+		clean["settings"] = settings
+	}
+	for _, field := range preservedOutboundFields {
+		if v, ok := out[field]; ok {
+			clean[field] = v
+		}
+	}
+
+	var dropped []string
+	if ss, ok := out["streamSettings"].(map[string]interface{}); ok {
+		clean["streamSettings"] = cleanStreamSettings(ss)
+		for k := range ss {
+			if !allowedStreamFields[k] {
+				dropped = append(dropped, "streamSettings."+k)
+			}
+		}
+	}
+	if mux, ok := out["mux"].(map[string]interface{}); ok {
+		if enabled, _ := mux["enabled"].(bool); !enabled {
+			clean["mux"] = map[string]interface{}{"enabled": false}
+		} else {
+			dropped = append(dropped, "mux")
+		}
+	}
+	for k := range out {
+		if _, ok := clean[k]; !ok && k != "mux" && k != "streamSettings" {
+			dropped = append(dropped, k)
+		}
+	}
+	sort.Strings(dropped)
+	return clean, dropped
+}
+
+// chainedTags returns the tags of the outbounds out sends its traffic
+// through, with the field naming each one.
+func chainedTags(out map[string]interface{}) [][2]string {
+	var tags [][2]string
+	if dp := getDialerProxy(out); dp != "" {
+		tags = append(tags, [2]string{dp, "sockopt.dialerProxy"})
+	}
+	if ps, ok := out["proxySettings"].(map[string]interface{}); ok {
+		if tag := stringField(ps, "tag"); tag != "" {
+			tags = append(tags, [2]string{tag, "proxySettings.tag"})
+		}
+	}
+	return tags
+}
+
+// XrayConfigChanges builds the per-IP test config once and lists what it
+// changes compared to config/xray_config.json. It fails for the same
+// reasons every Xray test would.
+func XrayConfigChanges() ([]string, error) {
+	_, _, changes, err := buildTempConfig("<IP>", xrayPortBase, nil)
+	return changes, err
+}
\ No newline at end of file
@@ -3,7 +3,6 @@ package scanner
 import (
 	"fmt"
 	"net"
-	"sort"
 	"strconv"
 	"sync"
 	"time"
@@ -14,8 +13,6 @@ import (
 const (
 	tcpConnectTimeout = 1 * time.Second
 	port              = 443
-	maxRoutines       = 200
-	defaultPingTimes  = 4
 )
 
 type PingResult struct {
@@ -23,6 +20,8 @@ type PingResult struct {
 	Sended   int
 	Received int
 	Delay    time.Duration
+	Samples  []time.Duration
+	Failures FailureCounts
 }
 
 func (p *PingResult) GetLossRate() float32 {
@@ -30,30 +29,43 @@ func (p *PingResult) GetLossRate() float32 {
 	return float32(lost) / float32(p.Sended)
 }
 
-func tcping(ip *net.IPAddr) (bool, time.Duration) {
-	start := time.Now()
+func tcping(stopCh <-chan struct{}, ip *net.IPAddr, timeout time.Duration) (time.Duration, error) {
 	var addr string
 	if isIPv4(ip.String()) {
 		addr = fmt.Sprintf("%s:%d", ip.String(), port)
 	} else {
 		addr = fmt.Sprintf("[%s]:%d", ip.String(), port)
 	}
-	conn, err := net.DialTimeout("tcp", addr, tcpConnectTimeout)
+	if !throttle(stopCh, PhasePing) {
+		return 0, errStopped
+	}
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", addr, timeout)
 	if err != nil {
-		return false, 0
+		return 0, err
 	}
 	conn.Close()
-	return true, time.Since(start)
+	return time.Since(start), nil
+}
+
+func isTimeout(err error) bool {
+	netErr, ok := err.(net.Error)
+	return ok && netErr.Timeout()
 }
 
-func checkConnection(ip *net.IPAddr) (recv int, totalDelay time.Duration) {
-	for i := 0; i < defaultPingTimes; i++ {
-		if ok, d := tcping(ip); ok {
-			recv++
-			totalDelay += d
+// checkConnection pings ip in the configured rounds and returns how many
+// probes were sent, the latency of the answered ones and why the others
+// failed.
+func checkConnection(stopCh <-chan struct{}, ip *net.IPAddr, limiter *adaptiveLimiter) (int, []time.Duration, FailureCounts) {
+	return opts.Ping.Rounds.run(tcpConnectTimeout, func(timeout time.Duration) (time.Duration, error) {
+		d, err := tcping(stopCh, ip, timeout)
+		if err == errStopped {
+			return 0, err
 		}
-	}
-	return
+		emitProbe(PhasePing, ip, d, err)
+		limiter.record(err != nil && isTimeout(err))
+		return d, err
+	})
 }
 
 func PingIPs(stopCh <-chan struct{}, ips []*net.IPAddr) []PingResult {
@@ -61,44 +73,44 @@ func PingIPs(stopCh <-chan struct{}, ips []*net.IPAddr) []PingResult {
 	var mu sync.Mutex
 	var wg sync.WaitGroup
 
-	control := make(chan struct{}, maxRoutines)
+	limiter := newAdaptiveLimiter(opts.Ping.Concurrency)
 	total := len(ips)
 
-	timeoutMs := int(tcpConnectTimeout.Milliseconds())
+	timeoutMs := int(firstTimeout(tcpConnectTimeout).Milliseconds())
 
 	cyan := color.New(color.FgCyan)
-	cyan.Printf("Start latency test (Mode: TCP, Port: %d, Range: 0 ~ %d ms, Packet Loss: 1.00)\n", port, timeoutMs)
+	cyan.Printf("Start latency test (Mode: TCP, Port: %d, Range: 0 ~ %d ms, Packet Loss: %.2f, Rounds: %d)\n", port, timeoutMs, opts.Scoring.Filters.MaxLoss, opts.Ping.Rounds.rounds())
 
 	bar := newBar(total, "Available:", "")
+	emitPhaseStart(PhasePing, total)
 
 	for _, ip := range ips {
-		select {
-		case <-stopCh:
+		if !limiter.acquire(stopCh) {
 			goto done
-		case control <- struct{}{}:
 		}
 
 		wg.Add(1)
 		go func(ipAddr *net.IPAddr) {
 			defer wg.Done()
-			defer func() { <-control }()
+			defer limiter.release()
 
-			recv, totalDelay := checkConnection(ipAddr)
+			sent, samples, failures := checkConnection(stopCh, ipAddr, limiter)
 
 			mu.Lock()
 			nowAble := len(results)
-			if recv != 0 {
+			if len(samples) != 0 {
 				nowAble++
 			}
+			bar.setExtra(fmt.Sprintf("Workers: %d", limiter.current()))
 			bar.grow(1, strconv.Itoa(nowAble))
-			if recv > 0 {
-				avg := totalDelay / time.Duration(recv)
-				results = append(results, PingResult{
-					IP:       ipAddr,
-					Sended:   defaultPingTimes,
-					Received: recv,
-					Delay:    avg,
-				})
+			if len(samples) > 0 {
+				pr := newPingResult(ipAddr, sent, samples)
+				pr.Failures = failures
+				results = append(results, pr)
+				r := NewIPResult(pr, 0)
+				emitIPDone(PhasePing, ipAddr, &r)
+			} else {
+				emitIPDone(PhasePing, ipAddr, nil)
 			}
 			mu.Unlock()
 		}(ip)
@@ -107,17 +119,14 @@ func PingIPs(stopCh <-chan struct{}, ips []*net.IPAddr) []PingResult {
 done:
 	wg.Wait()
 	bar.done()
+	emitPhaseEnd(PhasePing)
 
-	sort.Slice(results, func(i, j int) bool {
-		li, lj := results[i].GetLossRate(), results[j].GetLossRate()
-		if li != lj {
-			return li < lj
-		}
-		return results[i].Delay < results[j].Delay
-	})
+	results = filterPingResults(results)
+	sortPingResults(results)
 
-	fmt.Println()
+	fmt.Fprintln(output)
 	color.New(color.FgGreen).Printf("Latency test completed: %d responsive IPs found\n\n", len(results))
+	printFailureSummary(PhasePing)
 
 	return results
 }
\ No newline at end of file
@@ -0,0 +1,112 @@
+package scanner
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// RateLimitConfig caps how many new connections per second are opened.
+// Global applies to every phase together; the others apply on top of it to
+// a single phase. Zero means unlimited.
+type RateLimitConfig struct {
+	Global float64 `json:"global"`
+	Ping   float64 `json:"ping"`
+	Speed  float64 `json:"speed"`
+	Xray   float64 `json:"xray"`
+	Burst  int     `json:"burst"`
+}
+
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// errStopped is returned by probes that gave up waiting for a token
+// because the scan was stopped. They are not counted as sent.
+var errStopped = errors.New("scan stopped")
+
+// wait takes one token, sleeping until it is available or stop is closed,
+// and reports whether it got one. Tokens are reserved under the lock so
+// concurrent callers queue up fairly instead of all waking at once. A nil
+// bucket never blocks.
+func (b *tokenBucket) wait(stop <-chan struct{}) bool {
+	if b == nil {
+		return true
+	}
+
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	b.tokens--
+	var delay time.Duration
+	if b.tokens < 0 {
+		delay = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	b.mu.Unlock()
+
+	if delay <= 0 {
+		return true
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-stop:
+		b.mu.Lock()
+		b.tokens++
+		b.mu.Unlock()
+		return false
+	}
+}
+
+type rateLimiters struct {
+	global *tokenBucket
+	phases map[Phase]*tokenBucket
+}
+
+var limiters = newRateLimiters(DefaultOptions().RateLimit)
+
+func newRateLimiters(cfg RateLimitConfig) *rateLimiters {
+	xray := newTokenBucket(cfg.Xray, cfg.Burst)
+	ping := newTokenBucket(cfg.Ping, cfg.Burst)
+	return &rateLimiters{
+		global: newTokenBucket(cfg.Global, cfg.Burst),
+		phases: map[Phase]*tokenBucket{
+			PhasePing:      ping,
+			PhaseSNI:       ping,
+			PhaseSpeed:     newTokenBucket(cfg.Speed, cfg.Burst),
+			PhaseXrayPing:  xray,
+			PhaseXraySpeed: xray,
+		},
+	}
+}
+
+// throttle blocks until a new connection may be opened in phase p. It
+// returns false without waiting any longer once stop is closed.
+func throttle(stop <-chan struct{}, p Phase) bool {
+	return limiters.global.wait(stop) && limiters.phases[p].wait(stop)
+}
\ No newline at end of file
@@ -0,0 +1,26 @@
+package scanner
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucketStops(t *testing.T) {
+	b := newTokenBucket(0.01, 1)
+	if !b.wait(nil) {
+		t.Fatal("first token refused")
+	}
+
+	stop := make(chan struct{})
+	time.AfterFunc(10*ms, func() { close(stop) })
+	start := time.Now()
+	if b.wait(stop) {
+		t.Error("got a token after stop")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("wait returned after %v, want soon after stop", elapsed)
+	}
+	if b.tokens < -0.01 {
+		t.Errorf("tokens = %v, the reserved token was not given back", b.tokens)
+	}
+}
\ No newline at end of file
@@ -0,0 +1,103 @@
+package scanner
+
+import (
+	"time"
+)
+
+// ProbeRounds stages the latency probes of one IP. The first probe weeds
+// out dead IPs; only IPs that answer it get the remaining Rounds-1. Later
+// probes time out after TimeoutFactor times the slowest answer seen so
+// far, but never sooner than MinTimeoutMs, and an IP is dropped as soon as
+// it has lost more probes than the loss filter allows. With the default
+// MaxLoss of 1 that never happens and every IP that answers the first
+// probe gets all its rounds.
+type ProbeRounds struct {
+	Rounds        int     `json:"rounds"`
+	IntervalMs    int     `json:"interval_ms"`
+	TimeoutFactor float64 `json:"timeout_factor"`
+	MinTimeoutMs  int     `json:"min_timeout_ms"`
+}
+
+func DefaultTCPRounds() ProbeRounds {
+	return ProbeRounds{
+		Rounds:        4,
+		TimeoutFactor: 3,
+		MinTimeoutMs:  200,
+	}
+}
+
+func DefaultXrayRounds() ProbeRounds {
+	return ProbeRounds{
+		Rounds:        3,
+		IntervalMs:    50,
+		TimeoutFactor: 3,
+		MinTimeoutMs:  1000,
+	}
+}
+
+func (c ProbeRounds) rounds() int {
+	if c.Rounds < 1 {
+		return 1
+	}
+	return c.Rounds
+}
+
+// firstTimeout is the timeout of the first probe: base, or the delay
+// filter when that is lower since a slower IP would be dropped anyway.
+func firstTimeout(base time.Duration) time.Duration {
+	if max := time.Duration(opts.Scoring.Filters.MaxDelayMs) * time.Millisecond; max > 0 && max < base {
+		return max
+	}
+	return base
+}
+
+// timeout returns the timeout of the next probe after samples.
+func (c ProbeRounds) timeout(base time.Duration, samples []time.Duration) time.Duration {
+	first := firstTimeout(base)
+	if len(samples) == 0 || c.TimeoutFactor <= 0 {
+		return first
+	}
+	var slowest time.Duration
+	for _, s := range samples {
+		if s > slowest {
+			slowest = s
+		}
+	}
+	t := time.Duration(float64(slowest) * c.TimeoutFactor)
+	if min := time.Duration(c.MinTimeoutMs) * time.Millisecond; t < min {
+		t = min
+	}
+	if t > first {
+		t = first
+	}
+	return t
+}
+
+// run calls probe for each round with its timeout and returns how many
+// probes were sent, the latency of those that succeeded and why the
+// others failed.
+func (c ProbeRounds) run(base time.Duration, probe func(timeout time.Duration) (time.Duration, error)) (sent int, samples []time.Duration, failures FailureCounts) {
+	rounds := c.rounds()
+	for sent < rounds {
+		if sent > 0 && c.IntervalMs > 0 {
+			time.Sleep(time.Duration(c.IntervalMs) * time.Millisecond)
+		}
+		d, err := probe(c.timeout(base, samples))
+		if err == errStopped {
+			break
+		}
+		sent++
+		if err == nil {
+			samples = appendSample(samples, d)
+			continue
+		}
+		failures = failures.add(err)
+		if len(samples) == 0 {
+			break
+		}
+		if float64(failures.Total())/float64(rounds) > opts.Scoring.Filters.MaxLoss {
+			break
+		}
+	}
+	return
+}
\ No newline at end of file
@@ -0,0 +1,40 @@
+package scanner
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRunStopsOnLoss(t *testing.T) {
+	saved := opts.Scoring
+	defer func() { opts.Scoring = saved }()
+
+	// The IP answers the first probe and loses every later one.
+	lossy := func() func(time.Duration) (time.Duration, error) {
+		n := 0
+		return func(time.Duration) (time.Duration, error) {
+			n++
+			if n == 1 {
+				return 10 * time.Millisecond, nil
+			}
+			return 0, errors.New("lost")
+		}
+	}
+	c := ProbeRounds{Rounds: 8}
+
+	for _, tc := range []struct {
+		maxLoss float64
+		sent    int
+	}{
+		{1.0, 8},
+		{0.25, 4},
+		{0, 2},
+	} {
+		opts.Scoring.Filters.MaxLoss = tc.maxLoss
+		sent, samples, failures := c.run(time.Second, lossy())
+		if sent != tc.sent || len(samples) != 1 || failures.Total() != sent-1 {
+			t.Errorf("MaxLoss %.2f: sent %d with %d answers and %d failures, want %d sent", tc.maxLoss, sent, len(samples), failures.Total(), tc.sent)
+		}
+	}
+}
\ No newline at end of file
@@ -0,0 +1,155 @@
+package scanner
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Mode string
+
+const (
+	ModeNormal   Mode = "normal"
+	ModeXray     Mode = "xray"
+	ModeCombined Mode = "combined"
+)
+
+// Valid reports whether m is one of the scan modes.
+func (m Mode) Valid() bool {
+	return m == ModeNormal || m == ModeXray || m == ModeCombined
+}
+
+// UsesXray reports whether scans in mode m need the Xray core.
+func (m Mode) UsesXray() bool {
+	return m == ModeXray || m == ModeCombined
+}
+
+// exclusive serializes the scans and daemon cycles of one process, which
+// share the options, the Xray ports, the skip state and the failure
+// counters.
+var exclusive sync.Mutex
+
+// Exclusive waits until no other scan or daemon cycle holds the scanner
+// and returns the function that releases it again.
+func Exclusive() (release func()) {
+	exclusive.Lock()
+	return exclusive.Unlock
+}
+
+// TryExclusive is Exclusive without the wait: ok is false when the
+// scanner is busy.
+func TryExclusive() (release func(), ok bool) {
+	if !exclusive.TryLock() {
+		return nil, false
+	}
+	return exclusive.Unlock, true
+}
+
+// Report is the outcome of a complete scan.
+type Report struct {
+	Mode        Mode
+	Started     time.Time
+	Elapsed     time.Duration
+	PingResults []PingResult
+	Results     []IPResult
+	PingStopped bool
+	Interrupted bool
+}
+
+// Scan runs the latency phase followed by the speed phase, the same way for
+// the interactive tool and for background callers. Either phase can be
+// cut short from another goroutine. In combined mode the clean IPs of the
+// direct phases are then tested again through Xray, as part of the speed
+// phase.
+type Scan struct {
+	mode          Mode
+	stopPingCh    chan struct{}
+	stopSpeedCh   chan struct{}
+	stopPingOnce  sync.Once
+	stopSpeedOnce sync.Once
+	inSpeedPhase  int32
+}
+
+func NewScan(mode Mode) *Scan {
+	return &Scan{
+		mode:        mode,
+		stopPingCh:  make(chan struct{}),
+		stopSpeedCh: make(chan struct{}),
+	}
+}
+
+// StopPing ends the latency phase and continues with the IPs found so far.
+func (s *Scan) StopPing() {
+	s.stopPingOnce.Do(func() { close(s.stopPingCh) })
+}
+
+// StopSpeed ends the speed phase and keeps the results measured so far.
+func (s *Scan) StopSpeed() {
+	s.stopSpeedOnce.Do(func() { close(s.stopSpeedCh) })
+}
+
+// Stop ends the scan as soon as possible.
+func (s *Scan) Stop() {
+	s.StopPing()
+	s.StopSpeed()
+}
+
+func (s *Scan) InSpeedPhase() bool {
+	return atomic.LoadInt32(&s.inSpeedPhase) == 1
+}
+
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// Run scans ips and returns the ranked results. If history is not nil it is
+// used for the stability metric and updated with this run.
+func (s *Scan) Run(ips []*net.IPAddr, history *History) *Report {
+	report := &Report{Mode: s.mode, Started: time.Now()}
+
+	tally := newProbeTally()
+	unsubscribe := Subscribe(tally.observe)
+	if s.mode == ModeXray {
+		report.PingResults = PingIPsViaXray(s.stopPingCh, ips)
+	} else {
+		report.PingResults = PingIPs(s.stopPingCh, ips)
+	}
+	unsubscribe()
+	report.PingStopped = isClosed(s.stopPingCh)
+
+	if len(report.PingResults) == 0 {
+		report.Elapsed = time.Since(report.Started)
+		if history != nil {
+			history.Record(tally)
+		}
+		return report
+	}
+
+	atomic.StoreInt32(&s.inSpeedPhase, 1)
+	if s.mode == ModeXray {
+		report.Results = SpeedTestViaXray(s.stopSpeedCh, report.PingResults)
+	} else {
+		report.Results = SpeedTest(s.stopSpeedCh, report.PingResults)
+	}
+	if s.mode == ModeCombined && len(report.Results) > 0 && !isClosed(s.stopSpeedCh) {
+		validateThroughXray(s.stopSpeedCh, report.Results)
+		SortResults(report.Results)
+	}
+	report.Elapsed = time.Since(report.Started)
+	report.Interrupted = isClosed(s.stopSpeedCh)
+
+	if history != nil {
+		if len(report.Results) > 0 {
+			history.Apply(report.Results)
+			SortResults(report.Results)
+		}
+		history.Record(tally)
+	}
+	return report
+}
\ No newline at end of file
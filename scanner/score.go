@@ -0,0 +1,230 @@
+package scanner
+
+import (
+	"net"
+	"sort"
+	"time"
+)
+
+type Grade int
+
+const (
+	GradePoor Grade = iota
+	GradeFair
+	GradeGood
+)
+
+type ScoreWeights struct {
+	Loss      float64 `json:"loss"`
+	Latency   float64 `json:"latency"`
+	Jitter    float64 `json:"jitter"`
+	Download  float64 `json:"download"`
+	Upload    float64 `json:"upload"`
+	Stability float64 `json:"stability"`
+}
+
+// ScoreFilters are hard limits: an IP outside any of them is dropped no
+// matter how well it scores otherwise. Zero disables MaxDelayMs and
+// MinSpeed. MaxLoss is the share of lost probes allowed, from 0 to 1; the
+// default of 1 keeps every IP that answers at all and leaves loss to the
+// score.
+type ScoreFilters struct {
+	MaxLoss    float64 `json:"max_loss"`
+	MaxDelayMs int     `json:"max_delay_ms"`
+	MinSpeed   float64 `json:"min_speed"`
+}
+
+type ScoreConfig struct {
+	Weights ScoreWeights `json:"weights"`
+	Filters ScoreFilters `json:"filters"`
+
+	// Reference values used to normalize each metric to 0..1. Latency and
+	// jitter score zero at their reference; speeds score one at theirs.
+	LatencyRefMs int     `json:"latency_ref_ms"`
+	JitterRefMs  int     `json:"jitter_ref_ms"`
+	SpeedRef     float64 `json:"speed_ref"`
+
+	GoodScore float64 `json:"good_score"`
+	FairScore float64 `json:"fair_score"`
+}
+
+func DefaultScoreConfig() ScoreConfig {
+	return ScoreConfig{
+		Weights: ScoreWeights{
+			Loss:      0.35,
+			Latency:   0.25,
+			Jitter:    0.10,
+			Download:  0.25,
+			Upload:    0,
+			Stability: 0.05,
+		},
+		Filters: ScoreFilters{
+			MaxLoss: 1.0,
+		},
+		LatencyRefMs: 1000,
+		JitterRefMs:  200,
+		SpeedRef:     10,
+		GoodScore:    75,
+		FairScore:    50,
+	}
+}
+
+func clamp01(v float64) float64 {
+	if v < 0 {
+		return 0
+	}
+	if v > 1 {
+		return 1
+	}
+	return v
+}
+
+func lowerIsBetter(value, ref float64) float64 {
+	if ref <= 0 {
+		return 1
+	}
+	return 1 - clamp01(value/ref)
+}
+
+func higherIsBetter(value, ref float64) float64 {
+	if ref <= 0 {
+		return 0
+	}
+	return clamp01(value / ref)
+}
+
+// Score returns a value between 0 and 100 combining every metric of r
+// according to the configured weights.
+func (c ScoreConfig) Score(r IPResult) float64 {
+	w := c.Weights
+	total := w.Loss + w.Latency + w.Jitter + w.Download + w.Upload + w.Stability
+	if total <= 0 {
+		return 0
+	}
+
+	sum := w.Loss * (1 - clamp01(float64(r.LossRate)))
+	sum += w.Latency * lowerIsBetter(float64(r.Delay), float64(c.LatencyRefMs))
+	sum += w.Jitter * lowerIsBetter(float64(r.Jitter), float64(c.JitterRefMs))
+	sum += w.Download * higherIsBetter(r.DownloadSpeed/1024/1024, c.SpeedRef)
+	sum += w.Upload * higherIsBetter(r.UploadSpeed/1024/1024, c.SpeedRef)
+	sum += w.Stability * clamp01(r.Stability)
+
+	return sum / total * 100
+}
+
+func (c ScoreConfig) passesLatency(lossRate float32, delay time.Duration) bool {
+	if float64(lossRate) > c.Filters.MaxLoss {
+		return false
+	}
+	if c.Filters.MaxDelayMs > 0 && delay.Milliseconds() > int64(c.Filters.MaxDelayMs) {
+		return false
+	}
+	return true
+}
+
+func (c ScoreConfig) passesSpeed(bytesPerSec float64) bool {
+	return bytesPerSec/1024/1024 >= c.Filters.MinSpeed
+}
+
+// Passes reports whether r is within all hard filters.
+func (c ScoreConfig) Passes(r IPResult) bool {
+	return c.passesLatency(r.LossRate, time.Duration(r.Delay)*time.Millisecond) &&
+		c.passesSpeed(r.DownloadSpeed)
+}
+
+func (c ScoreConfig) Grade(r IPResult) Grade {
+	switch {
+	case r.Score >= c.GoodScore:
+		return GradeGood
+	case r.Score >= c.FairScore:
+		return GradeFair
+	default:
+		return GradePoor
+	}
+}
+
+// NewIPResult combines the latency statistics of pr with a measured
+// download speed in bytes per second.
+func NewIPResult(pr PingResult, downloadSpeed float64) IPResult {
+	stats := pr.Stats()
+	r := IPResult{
+		IP:            pr.IP,
+		Sended:        pr.Sended,
+		Received:      pr.Received,
+		LossRate:      pr.GetLossRate(),
+		Delay:         int(pr.Delay.Milliseconds()),
+		Jitter:        int(stats.Jitter.Milliseconds()),
+		MinDelay:      int(stats.Min.Milliseconds()),
+		MaxDelay:      int(stats.Max.Milliseconds()),
+		MedianDelay:   int(stats.Median.Milliseconds()),
+		P95Delay:      int(stats.P95.Milliseconds()),
+		DownloadSpeed: downloadSpeed,
+		Stability:     1,
+		Failures:      pr.Failures,
+	}
+	r.Score = opts.Scoring.Score(r)
+	return r
+}
+
+func filterPingResults(results []PingResult) []PingResult {
+	kept := results[:0]
+	for _, r := range results {
+		if opts.Scoring.passesLatency(r.GetLossRate(), r.Delay) {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
+
+func sortPingResults(results []PingResult) {
+	scores := make(map[*net.IPAddr]float64, len(results))
+	for _, r := range results {
+		scores[r.IP] = opts.Scoring.Score(NewIPResult(r, 0))
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		si, sj := scores[results[i].IP], scores[results[j].IP]
+		if si != sj {
+			return si > sj
+		}
+		return results[i].Delay < results[j].Delay
+	})
+}
+
+// SortResults fills in the Score of every result and orders them best first.
+func SortResults(results []IPResult) {
+	for i := range results {
+		results[i].Score = opts.Scoring.Score(results[i])
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if a, b := results[i].Tunnel.OK(), results[j].Tunnel.OK(); a != b {
+			return a
+		}
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].DownloadSpeed > results[j].DownloadSpeed
+	})
+}
+
+// TopResults returns at most n results that pass the hard filters, keeping
+// the order of results.
+func TopResults(results []IPResult, n int) []IPResult {
+	var top []IPResult
+	for _, r := range results {
+		if len(top) == n {
+			break
+		}
+		if opts.Scoring.Passes(r) {
+			top = append(top, r)
+		}
+	}
+	return top
+}
+
+func ScoreOf(r IPResult) float64 {
+	return opts.Scoring.Score(r)
+}
+
+func GradeOf(r IPResult) Grade {
+	return opts.Scoring.Grade(r)
+}
\ No newline at end of file
@@ -0,0 +1,253 @@
+package scanner
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ClientConfig returns the user's Xray config with the proxy outbound
+// pointed at ip. Everything else, key order and indentation included, is
+// kept as it is in the file.
+func ClientConfig(ip string) ([]byte, error) {
+	data, err := os.ReadFile(xrayConfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read config: %v", err)
+	}
+	doc, err := parseConfigDoc(data)
+	if err != nil {
+		return nil, err
+	}
+	proxyOutbound, _, err := findProxyOutbound(doc.root)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := setOutboundAddress(proxyOutbound, ip, outboundPort(proxyOutbound)); err != nil {
+		return nil, err
+	}
+	return doc.marshal()
+}
+
+func firstServer(outbound map[string]interface{}) map[string]interface{} {
+	settings, _ := outbound["settings"].(map[string]interface{})
+	if _, ok := settings["address"]; ok {
+		return settings
+	}
+	for _, key := range []string{"vnext", "servers"} {
+		if list, ok := settings[key].([]interface{}); ok && len(list) > 0 {
+			server, _ := list[0].(map[string]interface{})
+			return server
+		}
+	}
+	return nil
+}
+
+func outboundPort(outbound map[string]interface{}) int {
+	if server := firstServer(outbound); server != nil {
+		if p, ok := server["port"].(float64); ok && p > 0 {
+			return int(p)
+		}
+	}
+	return xrayPort
+}
+
+func stringField(m map[string]interface{}, key string) string {
+	v, _ := m[key].(string)
+	return v
+}
+
+func subMap(m map[string]interface{}, key string) map[string]interface{} {
+	sub, _ := m[key].(map[string]interface{})
+	if sub == nil {
+		return map[string]interface{}{}
+	}
+	return sub
+}
+
+// streamParams converts streamSettings into the query parameters used by
+// the common share link formats.
+func streamParams(outbound map[string]interface{}) url.Values {
+	ss := subMap(outbound, "streamSettings")
+	q := url.Values{}
+
+	network := stringField(ss, "network")
+	if network == "" {
+		network = "tcp"
+	}
+	q.Set("type", network)
+
+	security := stringField(ss, "security")
+	if security == "" {
+		security = "none"
+	}
+	q.Set("security", security)
+
+	var sec map[string]interface{}
+	switch security {
+	case "tls":
+		sec = subMap(ss, "tlsSettings")
+	case "reality":
+		sec = subMap(ss, "realitySettings")
+		if pbk := stringField(sec, "publicKey"); pbk != "" {
+			q.Set("pbk", pbk)
+		}
+		if sid := stringField(sec, "shortId"); sid != "" {
+			q.Set("sid", sid)
+		}
+	}
+	if sec != nil {
+		if sni := stringField(sec, "serverName"); sni != "" {
+			q.Set("sni", sni)
+		}
+		if fp := stringField(sec, "fingerprint"); fp != "" {
+			q.Set("fp", fp)
+		}
+		if alpn, ok := sec["alpn"].([]interface{}); ok && len(alpn) > 0 {
+			var parts []string
+			for _, a := range alpn {
+				if s, ok := a.(string); ok {
+					parts = append(parts, s)
+				}
+			}
+			q.Set("alpn", strings.Join(parts, ","))
+		}
+	}
+
+	var transport map[string]interface{}
+	switch network {
+	case "ws":
+		transport = subMap(ss, "wsSettings")
+	case "httpupgrade":
+		transport = subMap(ss, "httpupgradeSettings")
+	case "splithttp":
+		transport = subMap(ss, "splithttpSettings")
+	case "xhttp":
+		// Older configs keep xhttp settings under their previous name.
+		var ok bool
+		if transport, ok = ss["xhttpSettings"].(map[string]interface{}); !ok {
+			transport = subMap(ss, "splithttpSettings")
+		}
+	case "grpc":
+		if name := stringField(subMap(ss, "grpcSettings"), "serviceName"); name != "" {
+			q.Set("serviceName", name)
+		}
+	}
+	if transport != nil {
+		if path := stringField(transport, "path"); path != "" {
+			q.Set("path", path)
+		}
+		host := stringField(transport, "host")
+		if host == "" {
+			host = stringField(subMap(transport, "headers"), "Host")
+		}
+		if host != "" {
+			q.Set("host", host)
+		}
+	}
+	return q
+}
+
+func hostPort(ip string, port int) string {
+	return net.JoinHostPort(ip, strconv.Itoa(port))
+}
+
+// ShareLink builds a vless://, vmess://, trojan:// or ss:// link for the
+// proxy outbound of the user's Xray config with its address set to ip.
+func ShareLink(ip, name string) (string, error) {
+	cfg, err := readXrayConfig()
+	if err != nil {
+		return "", err
+	}
+	outbound, _, err := findProxyOutbound(cfg)
+	if err != nil {
+		return "", err
+	}
+	server := firstServer(outbound)
+	if server == nil {
+		return "", fmt.Errorf("proxy outbound has no server entry")
+	}
+	port := outboundPort(outbound)
+
+	var user map[string]interface{}
+	if users, ok := server["users"].([]interface{}); ok && len(users) > 0 {
+		user, _ = users[0].(map[string]interface{})
+	}
+	if user == nil {
+		user = map[string]interface{}{}
+	}
+
+	protocol := strings.ToLower(stringField(outbound, "protocol"))
+	q := streamParams(outbound)
+
+	switch protocol {
+	case "vless":
+		encryption := stringField(user, "encryption")
+		if encryption == "" {
+			encryption = "none"
+		}
+		q.Set("encryption", encryption)
+		if flow := stringField(user, "flow"); flow != "" {
+			q.Set("flow", flow)
+		}
+		u := url.URL{
+			Scheme:   "vless",
+			User:     url.User(stringField(user, "id")),
+			Host:     hostPort(ip, port),
+			RawQuery: q.Encode(),
+			Fragment: name,
+		}
+		return u.String(), nil
+
+	case "trojan":
+		u := url.URL{
+			Scheme:   "trojan",
+			User:     url.User(stringField(server, "password")),
+			Host:     hostPort(ip, port),
+			RawQuery: q.Encode(),
+			Fragment: name,
+		}
+		return u.String(), nil
+
+	case "shadowsocks":
+		userInfo := stringField(server, "method") + ":" + stringField(server, "password")
+		return fmt.Sprintf("ss://%s@%s#%s",
+			base64.RawURLEncoding.EncodeToString([]byte(userInfo)),
+			hostPort(ip, port), url.PathEscape(name)), nil
+
+	case "vmess":
+		tls := q.Get("security")
+		if tls == "none" {
+			tls = ""
+		}
+		aid := "0"
+		if v, ok := user["alterId"].(float64); ok {
+			aid = strconv.Itoa(int(v))
+		}
+		data, err := json.Marshal(map[string]string{
+			"v":    "2",
+			"ps":   name,
+			"add":  ip,
+			"port": strconv.Itoa(port),
+			"id":   stringField(user, "id"),
+			"aid":  aid,
+			"scy":  "auto",
+			"net":  q.Get("type"),
+			"type": "none",
+			"host": q.Get("host"),
+			"path": q.Get("path"),
+			"tls":  tls,
+			"sni":  q.Get("sni"),
+			"fp":   q.Get("fp"),
+		})
+		if err != nil {
+			return "", err
+		}
+		return "vmess://" + base64.StdEncoding.EncodeToString(data), nil
+	}
+	return "", fmt.Errorf("unsupported proxy protocol: %s", protocol)
+}
\ No newline at end of file
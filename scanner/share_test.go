@@ -0,0 +1,79 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// inConfigDir runs the test in a directory whose xray config is config.
+func inConfigDir(t *testing.T, config string) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(xrayConfigPath)), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, xrayConfigPath), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func TestClientConfigKeepsLayout(t *testing.T) {
+	inConfigDir(t, `{
+    "outbounds": [
+        {
+            "tag": "proxy",
+            "protocol": "vless",
+            "settings": {
+                "vnext": [
+                    {
+                        "address": "example.com",
+                        "port": 443,
+                        "users": [{"id": "uuid", "encryption": "none"}]
+                    }
+                ]
+            }
+        }
+    ],
+    "inbounds": []
+}
+`)
+	got, err := ClientConfig("1.2.3.4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{
+    "outbounds": [
+        {
+            "tag": "proxy",
+            "protocol": "vless",
+            "settings": {
+                "vnext": [
+                    {
+                        "address": "1.2.3.4",
+                        "port": 443,
+                        "users": [
+                            {
+                                "id": "uuid",
+                                "encryption": "none"
+                            }
+                        ]
+                    }
+                ]
+            }
+        }
+    ],
+    "inbounds": []
+}
+`
+	if string(got) != want {
+		t.Errorf("ClientConfig =\n%s\nwant\n%s", got, want)
+	}
+}
\ No newline at end of file
@@ -0,0 +1,265 @@
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SNIConfig controls the SNI sweep. The user's own server name and Host
+// from config/xray_config.json are always tried first when present.
+type SNIConfig struct {
+	Domains      []string `json:"domains"`
+	IncludeEmpty bool     `json:"include_empty"`
+	Path         string   `json:"path"`
+	TimeoutMs    int      `json:"timeout_ms"`
+	TopIPs       int      `json:"top_ips"`
+	Workers      int      `json:"workers"`
+}
+
+func DefaultSNIConfig() SNIConfig {
+	return SNIConfig{
+		Domains: []string{
+			"speed.cloudflare.com",
+			"www.cloudflare.com",
+			"discord.com",
+			"www.visa.com",
+			"www.udemy.com",
+		},
+		IncludeEmpty: true,
+		Path:         "/cdn-cgi/trace",
+		TimeoutMs:    3000,
+		TopIPs:       10,
+		Workers:      8,
+	}
+}
+
+// SNIResult is the outcome of one IP/SNI combination. An empty SNI means
+// the ClientHello carried no server name.
+type SNIResult struct {
+	IP         *net.IPAddr
+	SNI        string
+	TLS        bool
+	Cloudflare bool
+	Status     int
+	Handshake  time.Duration
+	Colo       string
+	Err        error
+}
+
+// OK reports whether the combination completed TLS and reached Cloudflare.
+func (r SNIResult) OK() bool {
+	return r.TLS && r.Cloudflare
+}
+
+// ConfigServerNames returns the TLS server name and HTTP Host of the proxy
+// outbound in the user's Xray config, if any.
+func ConfigServerNames() []string {
+	cfg, err := readXrayConfig()
+	if err != nil {
+		return nil
+	}
+	proxyOutbound, _, err := findProxyOutbound(cfg)
+	if err != nil {
+		return nil
+	}
+	q := streamParams(proxyOutbound)
+	var names []string
+	for _, key := range []string{"sni", "host"} {
+		if v := q.Get(key); v != "" {
+			names = append(names, v)
+		}
+	}
+	return names
+}
+
+// SNIList returns the server names to sweep, without duplicates, in the
+// order they are tried.
+func SNIList(c SNIConfig) []string {
+	seen := make(map[string]bool)
+	var list []string
+	for _, name := range append(ConfigServerNames(), c.Domains...) {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "" && !seen[name] {
+			seen[name] = true
+			list = append(list, name)
+		}
+	}
+	if c.IncludeEmpty {
+		list = append(list, "")
+	}
+	return list
+}
+
+func probeSNI(stopCh <-chan struct{}, ip *net.IPAddr, sni string, c SNIConfig) SNIResult {
+	result := SNIResult{IP: ip, SNI: sni}
+	timeout := time.Duration(c.TimeoutMs) * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if !throttle(stopCh, PhaseSNI) {
+		result.Err = errStopped
+		return result
+	}
+	start := time.Now()
+	raw, err := (&net.Dialer{}).DialContext(ctx, "tcp", net.JoinHostPort(ip.String(), "443"))
+	if err != nil {
+		result.Err = err
+		emitProbe(PhaseSNI, ip, 0, err)
+		return result
+	}
+	defer raw.Close()
+	raw.SetDeadline(time.Now().Add(timeout))
+
+	// The certificate is not checked: with an empty or foreign SNI it is
+	// not expected to match, and only reachability matters here.
+	conn, err := tlsHandshake(ctx, raw, sni, true)
+	if err != nil {
+		result.Err = err
+		emitProbe(PhaseSNI, ip, 0, err)
+		return result
+	}
+	result.TLS = true
+	result.Handshake = time.Since(start)
+
+	host := sni
+	if host == "" {
+		host = ip.String()
+	}
+	req := fmt.Sprintf("GET %s HTTP/1.1\r\nHost: %s\r\nUser-Agent: Mozilla/5.0\r\nConnection: close\r\n\r\n", c.Path, host)
+	if _, err := io.WriteString(conn, req); err != nil {
+		result.Err = err
+		emitProbe(PhaseSNI, ip, 0, err)
+		return result
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		result.Err = err
+		emitProbe(PhaseSNI, ip, 0, err)
+		return result
+	}
+	resp.Body.Close()
+
+	result.Status = resp.StatusCode
+	ray := resp.Header.Get("Cf-Ray")
+	result.Cloudflare = ray != "" || strings.EqualFold(resp.Header.Get("Server"), "cloudflare")
+	if i := strings.LastIndex(ray, "-"); i >= 0 {
+		result.Colo = ray[i+1:]
+	}
+	if !result.Cloudflare {
+		result.Err = fmt.Errorf("response is not from Cloudflare")
+	}
+	emitProbe(PhaseSNI, ip, result.Handshake, result.Err)
+	return result
+}
+
+// SweepSNI tries every name from SNIList against every IP and returns the
+// results grouped by IP in the order of ips.
+func SweepSNI(stopCh <-chan struct{}, ips []*net.IPAddr, c SNIConfig) []SNIResult {
+	names := SNIList(c)
+	type job struct {
+		index int
+		ip    *net.IPAddr
+		sni   string
+	}
+	jobs := make(chan job)
+	results := make([]SNIResult, len(ips)*len(names))
+	done := make([]bool, len(results))
+
+	workers := c.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	total := len(results)
+	emitPhaseStart(PhaseSNI, total)
+	bar := newBar(total, "Working:", "")
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	working := 0
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				r := probeSNI(stopCh, j.ip, j.sni, c)
+				if r.Err == errStopped {
+					continue
+				}
+				mu.Lock()
+				results[j.index] = r
+				done[j.index] = true
+				if r.OK() {
+					working++
+				}
+				count := working
+				mu.Unlock()
+				bar.grow(1, strconv.Itoa(count))
+			}
+		}()
+	}
+
+feed:
+	for i, ip := range ips {
+		for k, name := range names {
+			select {
+			case <-stopCh:
+				break feed
+			case jobs <- job{index: i*len(names) + k, ip: ip, sni: name}:
+			}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	bar.done()
+	emitPhaseEnd(PhaseSNI)
+
+	finished := results[:0]
+	for i, r := range results {
+		if done[i] {
+			finished = append(finished, r)
+		}
+	}
+	return finished
+}
+
+// SNISummary counts, for every SNI, on how many IPs it worked. Names are
+// sorted by that count.
+type SNISummary struct {
+	SNI     string
+	Working int
+	Tested  int
+}
+
+func SummarizeSNI(results []SNIResult) []SNISummary {
+	byName := make(map[string]*SNISummary)
+	var order []string
+	for _, r := range results {
+		s, ok := byName[r.SNI]
+		if !ok {
+			s = &SNISummary{SNI: r.SNI}
+			byName[r.SNI] = s
+			order = append(order, r.SNI)
+		}
+		s.Tested++
+		if r.OK() {
+			s.Working++
+		}
+	}
+	summary := make([]SNISummary, len(order))
+	for i, name := range order {
+		summary[i] = *byName[name]
+	}
+	sort.SliceStable(summary, func(i, j int) bool {
+		return summary[i].Working > summary[j].Working
+	})
+	return summary
+}
\ No newline at end of file
@@ -6,173 +6,324 @@ import (
 	"io"
 	"net"
 	"net/http"
-	"sort"
 	"strconv"
+	"sync"
 	"time"
 
-	"github.com/VividCortex/ewma"
 	"github.com/fatih/color"
 )
 
 const (
-	bufferSize      = 1024
 	downloadURL     = "https://speed.cloudflare.com/__down?bytes=52428800"
 	downloadTimeout = 10 * time.Second
 	defaultTestNum  = 10
-	minSpeed        = 0.0
 )
 
+// SpeedConfig sets what the speed test downloads. Each candidate IP is
+// dialed directly with the host of URL as Host and SNI, so URL can point at
+// any domain behind Cloudflare, such as one serving the speed-server
+// command. In Xray mode URL is downloaded through the tunnel instead. With
+// UploadURL set, UploadBytes are also posted there and the upload speed is
+// recorded.
+//
+// The speed test walks down the responsive IPs, fastest ping first, until
+// Wanted of them reach the minimum speed of the score filters or MaxTest
+// have been tried. MaxTest 0 allows the whole list.
+type SpeedConfig struct {
+	URL         string `json:"url"`
+	UploadURL   string `json:"upload_url"`
+	UploadBytes int64  `json:"upload_bytes"`
+	Wanted      int    `json:"wanted"`
+	MaxTest     int    `json:"max_test"`
+}
+
+func DefaultSpeedConfig() SpeedConfig {
+	return SpeedConfig{
+		URL:         downloadURL,
+		UploadBytes: 10 * 1024 * 1024,
+		Wanted:      defaultTestNum,
+		MaxTest:     50,
+	}
+}
+
+// queue returns how many IPs the speed test wants and how many of the
+// available ones it may test to find them.
+func (c SpeedConfig) queue(available int) (wanted, maxTest int) {
+	wanted, maxTest = c.Wanted, c.MaxTest
+	if wanted <= 0 {
+		wanted = defaultTestNum
+	}
+	if maxTest <= 0 || maxTest > available {
+		maxTest = available
+	}
+	if wanted > maxTest {
+		wanted = maxTest
+	}
+	return wanted, maxTest
+}
+
+// fastEnough reports whether a download makes its IP clean. A download
+// that failed or delivered nothing never does, even without a minimum
+// speed.
+func fastEnough(t Throughput, err error) bool {
+	return err == nil && t.Mean > 0 && opts.Scoring.passesSpeed(t.Mean)
+}
+
+func (c SpeedConfig) downloadURL() string {
+	if c.URL == "" {
+		return downloadURL
+	}
+	return c.URL
+}
+
 type IPResult struct {
 	IP            *net.IPAddr
 	Sended        int
 	Received      int
 	LossRate      float32
 	Delay         int
+	Jitter        int
+	MinDelay      int
+	MaxDelay      int
+	MedianDelay   int
+	P95Delay      int
 	DownloadSpeed float64
+	PeakSpeed     float64
+	TTFB          int
+	UploadSpeed   float64
+	Stability     float64
+	Score         float64
+	Failures      FailureCounts
+
+	// Tunnel is set in combined mode to the results through Xray.
+	Tunnel *TunnelResult
 }
 
+// getDialContext dials ip instead of the host being requested, on the
+// port of the request URL.
 func getDialContext(ip *net.IPAddr) func(ctx context.Context, network, address string) (net.Conn, error) {
-	var fakeSourceAddr string
-	if isIPv4(ip.String()) {
-		fakeSourceAddr = fmt.Sprintf("%s:%d", ip.String(), port)
-	} else {
-		fakeSourceAddr = fmt.Sprintf("[%s]:%d", ip.String(), port)
-	}
 	return func(ctx context.Context, network, address string) (net.Conn, error) {
-		return (&net.Dialer{}).DialContext(ctx, network, fakeSourceAddr)
+		if !throttle(ctx.Done(), PhaseSpeed) {
+			return nil, ctx.Err()
+		}
+		targetPort := strconv.Itoa(port)
+		if _, p, err := net.SplitHostPort(address); err == nil {
+			targetPort = p
+		}
+		return (&net.Dialer{}).DialContext(ctx, network, net.JoinHostPort(ip.String(), targetPort))
 	}
 }
 
-func downloadHandler(ip *net.IPAddr) float64 {
-	client := &http.Client{
-		Transport: &http.Transport{
-			DialContext: getDialContext(ip),
-		},
-		Timeout: downloadTimeout,
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			if len(via) > 10 {
-				return http.ErrUseLastResponse
-			}
-			if req.Header.Get("Referer") == downloadURL {
-				req.Header.Del("Referer")
-			}
-			return nil
-		},
+// getDialTLSContext dials like getDialContext and then runs the TLS
+// handshake itself, so the configured fingerprint is used.
+func getDialTLSContext(ip *net.IPAddr) func(ctx context.Context, network, address string) (net.Conn, error) {
+	dial := getDialContext(ip)
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := dial(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			host = address
+		}
+		tlsConn, err := tlsHandshake(ctx, conn, host, false)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return tlsConn, nil
 	}
+}
 
-	req, err := http.NewRequest("GET", downloadURL, nil)
-	if err != nil {
-		return 0.0
+// speedClient returns a client whose connections all go to ip.
+func speedClient(ip *net.IPAddr) *http.Client {
+	transport := &http.Transport{
+		DialContext: getDialContext(ip),
 	}
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_12_6) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/98.0.4758.80 Safari/537.36")
-
-	response, err := client.Do(req)
-	if err != nil {
-		return 0.0
+	if Fingerprint() != "" {
+		transport.DialTLSContext = getDialTLSContext(ip)
 	}
-	defer response.Body.Close()
-
-	if response.StatusCode != 200 {
-		return 0.0
+	return &http.Client{
+		Transport: transport,
+		Timeout:   downloadTimeout,
 	}
+}
 
-	timeStart := time.Now()
-	timeEnd := timeStart.Add(downloadTimeout)
-	contentLength := response.ContentLength
-	buffer := make([]byte, bufferSize)
+var skipState struct {
+	mu     sync.Mutex
+	cancel context.CancelFunc
+}
 
-	var (
-		contentRead     int64 = 0
-		timeSlice             = downloadTimeout / 100
-		timeCounter           = 1
-		lastContentRead int64 = 0
-	)
+// SkipCurrent aborts the download of the IP that is being speed tested
+// right now. The IP is dropped and the speed test moves on to the next one.
+func SkipCurrent() {
+	skipState.mu.Lock()
+	defer skipState.mu.Unlock()
+	if skipState.cancel != nil {
+		skipState.cancel()
+	}
+}
 
-	nextTime := timeStart.Add(timeSlice * time.Duration(timeCounter))
-	e := ewma.NewMovingAverage()
+func skippableContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	skipState.mu.Lock()
+	skipState.cancel = cancel
+	skipState.mu.Unlock()
+	return ctx, func() {
+		skipState.mu.Lock()
+		skipState.cancel = nil
+		skipState.mu.Unlock()
+		cancel()
+	}
+}
 
-	for contentLength != contentRead {
-		currentTime := time.Now()
-		if currentTime.After(nextTime) {
-			timeCounter++
-			nextTime = timeStart.Add(timeSlice * time.Duration(timeCounter))
-			e.Add(float64(contentRead - lastContentRead))
-			lastContentRead = contentRead
+// downloadHandler measures the download from ip. The error is set when
+// the download could not be started at all.
+func downloadHandler(ctx context.Context, ip *net.IPAddr) (Throughput, error) {
+	url := opts.Speed.downloadURL()
+	client := speedClient(ip)
+	client.Timeout = 0
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) > 10 {
+			return http.ErrUseLastResponse
 		}
-		if currentTime.After(timeEnd) {
-			break
+		if req.Header.Get("Referer") == url {
+			req.Header.Del("Referer")
 		}
-		n, err := response.Body.Read(buffer)
+		return nil
+	}
+
+	return measureDownload(ctx, PhaseSpeed, func(ctx context.Context) (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 		if err != nil {
-			if err != io.EOF {
-				break
-			} else if contentLength == -1 {
-				break
-			}
-			lastSlice := timeStart.Add(timeSlice * time.Duration(timeCounter-1))
-			e.Add(float64(contentRead-lastContentRead) / (float64(currentTime.Sub(lastSlice)) / float64(timeSlice)))
+			return nil, err
+		}
+		req.Header.Set("User-Agent", probeUserAgent)
+
+		response, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if response.StatusCode != 200 {
+			response.Body.Close()
+			return nil, statusError(response.StatusCode)
 		}
-		contentRead += int64(n)
+		return response, nil
+	})
+}
+
+// uploadHandler posts opts.Speed.UploadBytes to the upload URL through ip
+// and returns the upload speed in bytes per second.
+func uploadHandler(ctx context.Context, ip *net.IPAddr) (float64, error) {
+	size := opts.Speed.UploadBytes
+	if size <= 0 {
+		size = DefaultSpeedConfig().UploadBytes
 	}
+	body := &countingReader{r: io.LimitReader(zeroReader{}, size), phase: PhaseSpeed}
+	req, err := http.NewRequestWithContext(ctx, "POST", opts.Speed.UploadURL, body)
+	if err != nil {
+		return 0.0, err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("User-Agent", probeUserAgent)
 
-	return e.Value() / (downloadTimeout.Seconds() / 120)
+	start := time.Now()
+	response, err := speedClient(ip).Do(req)
+	if err != nil {
+		return 0.0, err
+	}
+	io.Copy(io.Discard, response.Body)
+	response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return 0.0, statusError(response.StatusCode)
+	}
+	return float64(size) / time.Since(start).Seconds(), nil
 }
 
-func SpeedTest(stopCh <-chan struct{}, pingResults []PingResult) []IPResult {
-	testCount := defaultTestNum
-	testNum := testCount
-	if len(pingResults) < testCount {
-		testNum = len(pingResults)
-		testCount = testNum
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
 	}
+	return len(p), nil
+}
+
+func SpeedTest(stopCh <-chan struct{}, pingResults []PingResult) []IPResult {
+	return SpeedTestWith(stopCh, pingResults, opts.Speed)
+}
+
+// SpeedTestWith is SpeedTest with the Wanted and MaxTest of c instead of
+// the configured ones, for callers that need a given number of IPs.
+func SpeedTestWith(stopCh <-chan struct{}, pingResults []PingResult, c SpeedConfig) []IPResult {
+	wanted, maxTest := c.queue(len(pingResults))
 
 	barPadding := "     "
 	for i := 0; i < len(strconv.Itoa(len(pingResults))); i++ {
 		barPadding += " "
 	}
 
-	color.New(color.FgCyan).Printf("Start download speed test (Minimum speed: %.2f MB/s, Number: %d, Queue: %d)\n", minSpeed, testCount, testNum)
+	if url := opts.Speed.downloadURL(); url != downloadURL {
+		color.New(color.FgCyan).Printf("Speed test URL: %s\n", url)
+	}
+	color.New(color.FgCyan).Printf("Start download speed test (Minimum speed: %.2f MB/s, Wanted: %d, Max to test: %d of %d)\n", opts.Scoring.Filters.MinSpeed, wanted, maxTest, len(pingResults))
 
-	bar := newBar(testCount, barPadding, "")
+	bar := newBar(wanted, barPadding, "")
+	emitPhaseStart(PhaseSpeed, maxTest)
 
 	var results []IPResult
 
-	for i := 0; i < testNum; i++ {
+	for i := 0; i < maxTest; i++ {
 		select {
 		case <-stopCh:
 			goto done
 		default:
 		}
+		bar.setExtra(fmt.Sprintf("tested %d/%d", i+1, maxTest))
 
 		pr := pingResults[i]
-		speed := downloadHandler(pr.IP)
+		ctx, cancel := skippableContext()
+		t, err := downloadHandler(ctx, pr.IP)
+		skipped := ctx.Err() != nil
+		cancel()
+		if !skipped {
+			emitProbe(PhaseSpeed, pr.IP, 0, err)
+		}
 
-		if speed >= minSpeed {
+		if !skipped && fastEnough(t, err) {
 			bar.grow(1, "")
-			results = append(results, IPResult{
-				IP:            pr.IP,
-				Sended:        pr.Sended,
-				Received:      pr.Received,
-				LossRate:      pr.GetLossRate(),
-				Delay:         int(pr.Delay.Milliseconds()),
-				DownloadSpeed: speed,
-			})
-			if len(results) == testCount {
+			r := NewIPResult(pr, t.Mean)
+			r.PeakSpeed, r.TTFB = t.Peak, int(t.TTFB.Milliseconds())
+			if opts.Speed.UploadURL != "" {
+				ctx, cancel := skippableContext()
+				upload, err := uploadHandler(ctx, pr.IP)
+				if ctx.Err() == nil {
+					emitProbe(PhaseSpeed, pr.IP, 0, err)
+				}
+				cancel()
+				r.UploadSpeed = upload
+				r.Score = opts.Scoring.Score(r)
+			}
+			results = append(results, r)
+			emitIPDone(PhaseSpeed, pr.IP, &r)
+			if len(results) == wanted {
 				break
 			}
+		} else {
+			emitIPDone(PhaseSpeed, pr.IP, nil)
 		}
 	}
 
 done:
 	bar.done()
+	emitPhaseEnd(PhaseSpeed)
 
-	if len(results) > 0 {
-		sort.Slice(results, func(i, j int) bool {
-			return results[i].DownloadSpeed > results[j].DownloadSpeed
-		})
-	}
+	SortResults(results)
 
-	fmt.Println()
+	fmt.Fprintln(output)
 	color.New(color.FgGreen).Printf("Speed test completed: %d clean IPs found\n\n", len(results))
+	printFailureSummary(PhaseSpeed)
 	return results
 }
\ No newline at end of file
@@ -0,0 +1,93 @@
+package scanner
+
+import (
+	"net"
+	"sort"
+	"time"
+)
+
+// maxLatencySamples bounds how many individual probe times are kept per IP.
+const maxLatencySamples = 32
+
+type LatencyStats struct {
+	Min    time.Duration
+	Max    time.Duration
+	Median time.Duration
+	P95    time.Duration
+	Jitter time.Duration
+}
+
+func appendSample(samples []time.Duration, d time.Duration) []time.Duration {
+	if len(samples) >= maxLatencySamples {
+		return samples
+	}
+	return append(samples, d)
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(p*float64(len(sorted))+0.5) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
+}
+
+// computeLatencyStats derives distribution statistics from samples in the
+// order they were taken. Jitter is the mean absolute difference between
+// consecutive samples.
+func computeLatencyStats(samples []time.Duration) LatencyStats {
+	if len(samples) == 0 {
+		return LatencyStats{}
+	}
+
+	var jitter time.Duration
+	for i := 1; i < len(samples); i++ {
+		diff := samples[i] - samples[i-1]
+		if diff < 0 {
+			diff = -diff
+		}
+		jitter += diff
+	}
+	if len(samples) > 1 {
+		jitter /= time.Duration(len(samples) - 1)
+	}
+
+	sorted := make([]time.Duration, len(samples))
+	copy(sorted, samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	return LatencyStats{
+		Min:    sorted[0],
+		Max:    sorted[len(sorted)-1],
+		Median: percentile(sorted, 0.5),
+		P95:    percentile(sorted, 0.95),
+		Jitter: jitter,
+	}
+}
+
+func newPingResult(ip *net.IPAddr, sent int, samples []time.Duration) PingResult {
+	var total time.Duration
+	for _, s := range samples {
+		total += s
+	}
+	r := PingResult{
+		IP:       ip,
+		Sended:   sent,
+		Received: len(samples),
+		Samples:  samples,
+	}
+	if len(samples) > 0 {
+		r.Delay = total / time.Duration(len(samples))
+	}
+	return r
+}
+
+func (p *PingResult) Stats() LatencyStats {
+	return computeLatencyStats(p.Samples)
+}
\ No newline at end of file
@@ -0,0 +1,154 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// probeBodyLimit is how much of a latency response is read to look for
+// ProbeTarget.Contains.
+const probeBodyLimit = 64 * 1024
+
+const probeUserAgent = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_12_6) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/98.0.4758.80 Safari/537.36"
+
+// ProbeTarget is a URL requested through Xray. A response counts when its
+// status is one of Status and, for latency targets, its body contains
+// Contains. An empty Status accepts any 2xx.
+type ProbeTarget struct {
+	URL      string `json:"url"`
+	Status   []int  `json:"status"`
+	Contains string `json:"contains"`
+}
+
+// ProbeConfig lists the targets of the Xray latency and speed tests. Each
+// list is tried in order: when a target fails for an IP the next one is
+// tried, and the first that answers is kept for the rest of that IP.
+//
+// The Xray speed test downloads the URL of SpeedConfig first, like the
+// direct one, so Speed only holds the fallbacks tried after it.
+type ProbeConfig struct {
+	Latency []ProbeTarget `json:"latency"`
+	Speed   []ProbeTarget `json:"speed"`
+}
+
+func DefaultProbeConfig() ProbeConfig {
+	return ProbeConfig{
+		Latency: []ProbeTarget{
+			{URL: "https://cp.cloudflare.com/generate_204", Status: []int{200, 204}},
+		},
+	}
+}
+
+// ValidateProbeConfig returns an error naming the first target that
+// cannot be requested.
+func ValidateProbeConfig(c ProbeConfig) error {
+	if err := validateTargets("latency", c.Latency); err != nil {
+		return err
+	}
+	return validateTargets("speed", c.Speed)
+}
+
+func validateTargets(kind string, targets []ProbeTarget) error {
+	for i, t := range targets {
+		if _, err := http.NewRequest("GET", t.URL, nil); err != nil {
+			return fmt.Errorf("%s target %d: %v", kind, i+1, err)
+		}
+		if !strings.HasPrefix(t.URL, "http://") && !strings.HasPrefix(t.URL, "https://") {
+			return fmt.Errorf("%s target %d: %q is not an http or https URL", kind, i+1, t.URL)
+		}
+	}
+	return nil
+}
+
+// latencyTargets falls back to the defaults when the settings leave the
+// list empty.
+func latencyTargets() []ProbeTarget {
+	if len(opts.Probe.Latency) == 0 {
+		return DefaultProbeConfig().Latency
+	}
+	return opts.Probe.Latency
+}
+
+// speedTargets starts with the download URL of the speed settings and
+// goes on with the fallbacks.
+func speedTargets() []ProbeTarget {
+	primary := ProbeTarget{URL: opts.Speed.downloadURL(), Status: []int{200}}
+	return append([]ProbeTarget{primary}, opts.Probe.Speed...)
+}
+
+func (t ProbeTarget) statusOK(code int) bool {
+	if len(t.Status) == 0 {
+		return code >= 200 && code < 300
+	}
+	for _, s := range t.Status {
+		if s == code {
+			return true
+		}
+	}
+	return false
+}
+
+// get requests t and checks the status. The caller closes the body.
+func (t ProbeTarget) get(ctx context.Context, client *http.Client) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", t.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", probeUserAgent)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if !t.statusOK(resp.StatusCode) {
+		resp.Body.Close()
+		return nil, statusError(resp.StatusCode)
+	}
+	return resp, nil
+}
+
+// check requests t, reads the body and looks for Contains in it.
+func (t ProbeTarget) check(ctx context.Context, client *http.Client) error {
+	resp, err := t.get(ctx, client)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, probeBodyLimit))
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	if t.Contains != "" && !bytes.Contains(body, []byte(t.Contains)) {
+		return failWith(FailureContent, fmt.Errorf("response of %s does not contain %q", t.URL, t.Contains))
+	}
+	return nil
+}
+
+// targetList walks a list of targets for one IP, starting each attempt
+// at the last target that answered.
+type targetList struct {
+	targets []ProbeTarget
+	current int
+}
+
+// try calls fn with each target in turn until one succeeds and returns
+// the error of the first target tried when none does.
+func (l *targetList) try(fn func(ProbeTarget) error) error {
+	var first error
+	for i := 0; i < len(l.targets); i++ {
+		k := (l.current + i) % len(l.targets)
+		err := fn(l.targets[k])
+		if err == nil {
+			l.current = k
+			return nil
+		}
+		if first == nil {
+			first = err
+		}
+	}
+	return first
+}
\ No newline at end of file
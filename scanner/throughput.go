@@ -0,0 +1,184 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+const (
+	throughputBufferSize = 32 * 1024
+	throughputWarmUp     = time.Second
+	throughputSlice      = 250 * time.Millisecond
+)
+
+// Throughput is the outcome of one download. Mean and Peak are in bytes
+// per second and leave out connection setup and the warm-up; TTFB is the
+// time from sending the request to the first byte of the response.
+type Throughput struct {
+	Mean  float64
+	Peak  float64
+	TTFB  time.Duration
+	Bytes int64
+}
+
+// meter measures how fast a body arrives. Reading stops window after the
+// first byte. Bytes that arrive in the first warmUp are not counted, so
+// TCP slow start does not drag the result down, unless the body ends
+// before the warm-up does. Peak is the best rate over a slice.
+type meter struct {
+	window time.Duration
+	warmUp time.Duration
+	slice  time.Duration
+	now    func() time.Time
+}
+
+func newMeter(window time.Duration) meter {
+	return meter{
+		window: window,
+		warmUp: throughputWarmUp,
+		slice:  throughputSlice,
+		now:    time.Now,
+	}
+}
+
+var errEmptyBody = errors.New("no data received")
+
+// measure reads body until it ends, fails or the window is over. The
+// error is only set when no data arrived at all.
+func (m meter) measure(body io.Reader) (Throughput, error) {
+	var t Throughput
+	buf := make([]byte, throughputBufferSize)
+
+	// Rates are taken from base on, the first read after the warm-up or,
+	// until then, the very first read.
+	var first, base, end, sliceStart time.Time
+	var baseBytes, sliceBytes int64
+	var peak float64
+	warm := false
+
+	for {
+		n, err := body.Read(buf)
+		now := m.now()
+		if n > 0 {
+			t.Bytes += int64(n)
+			end = now
+			switch {
+			case first.IsZero():
+				first, base, sliceStart = now, now, now
+				baseBytes = t.Bytes
+			case !warm && now.Sub(first) >= m.warmUp:
+				warm = true
+				base, sliceStart = now, now
+				baseBytes, sliceBytes = t.Bytes, 0
+				peak = 0
+			default:
+				sliceBytes += int64(n)
+				if d := now.Sub(sliceStart); d >= m.slice {
+					peak = math.Max(peak, float64(sliceBytes)/d.Seconds())
+					sliceStart, sliceBytes = now, 0
+				}
+			}
+		}
+		if first.IsZero() {
+			if err == io.EOF {
+				return t, errEmptyBody
+			}
+			if err != nil {
+				return t, err
+			}
+			continue
+		}
+		if err != nil || now.Sub(first) >= m.window {
+			break
+		}
+	}
+
+	if d := end.Sub(base); d > 0 {
+		t.Mean = float64(t.Bytes-baseBytes) / d.Seconds()
+	}
+	t.Peak = math.Max(peak, t.Mean)
+	return t, nil
+}
+
+// measureDownload sends a request with do and measures the response body.
+// Connecting and waiting for the response may take up to downloadTimeout,
+// and the body is then read for up to downloadTimeout on its own, so a
+// slow handshake does not shorten the measurement. The client used by do
+// must not set its own Timeout.
+func measureDownload(ctx context.Context, phase Phase, do func(context.Context) (*http.Response, error)) (Throughput, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	var wrote, firstByte time.Time
+	var tlsStarted, gotConn, expired bool
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		TLSHandshakeStart: func() {
+			mu.Lock()
+			tlsStarted = true
+			mu.Unlock()
+		},
+		GotConn: func(httptrace.GotConnInfo) {
+			mu.Lock()
+			gotConn = true
+			mu.Unlock()
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			mu.Lock()
+			wrote = time.Now()
+			mu.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			mu.Lock()
+			firstByte = time.Now()
+			mu.Unlock()
+		},
+	})
+	expire := func() {
+		mu.Lock()
+		expired = true
+		mu.Unlock()
+		cancel()
+	}
+
+	timer := time.AfterFunc(downloadTimeout, expire)
+	resp, err := do(ctx)
+	timer.Stop()
+	mu.Lock()
+	switch {
+	case err == nil:
+	case !expired:
+	case !gotConn && tlsStarted:
+		err = failWith(FailureTLS, err)
+	case !gotConn:
+		err = failWith(FailureConnectTimeout, err)
+	default:
+		err = failWith(FailureReadTimeout, err)
+	}
+	expired = false
+	mu.Unlock()
+	if err != nil {
+		return Throughput{}, err
+	}
+	defer resp.Body.Close()
+
+	timer = time.AfterFunc(downloadTimeout, expire)
+	t, err := newMeter(downloadTimeout).measure(&countingReader{r: resp.Body, phase: phase})
+	timer.Stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if err != nil && expired {
+		err = failWith(FailureReadTimeout, err)
+	}
+	if !wrote.IsZero() && firstByte.After(wrote) {
+		t.TTFB = firstByte.Sub(wrote)
+	}
+	return t, err
+}
\ No newline at end of file
@@ -0,0 +1,202 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// read is one Read of a fakeBody: n bytes, then err, at a time after the
+// start of the download.
+type read struct {
+	at  time.Duration
+	n   int
+	err error
+}
+
+// fakeBody replays reads and moves the clock of its meter along.
+type fakeBody struct {
+	reads []read
+	next  int
+	now   time.Duration
+}
+
+func (b *fakeBody) Read(p []byte) (int, error) {
+	if b.next == len(b.reads) {
+		return 0, io.EOF
+	}
+	r := b.reads[b.next]
+	b.next++
+	b.now = r.at
+	return r.n, r.err
+}
+
+func (b *fakeBody) meter(window time.Duration) meter {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := newMeter(window)
+	m.now = func() time.Time { return start.Add(b.now) }
+	return m
+}
+
+// every returns reads of n bytes every interval from from to to, both
+// included.
+func every(from, to, interval time.Duration, n int) []read {
+	var reads []read
+	for at := from; at <= to; at += interval {
+		reads = append(reads, read{at: at, n: n})
+	}
+	return reads
+}
+
+func near(got, want float64) bool {
+	return math.Abs(got-want) < want*1e-9
+}
+
+const ms = time.Millisecond
+
+func TestMeterLeavesOutWarmUp(t *testing.T) {
+	// 10 kB/s during the warm-up, then 100 kB/s.
+	reads := every(0, 900*ms, 100*ms, 1000)
+	reads = append(reads, every(1000*ms, 3000*ms, 100*ms, 10000)...)
+	b := &fakeBody{reads: reads}
+
+	got, err := b.meter(10 * time.Second).measure(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Bytes != 10*1000+21*10000 {
+		t.Errorf("Bytes = %d", got.Bytes)
+	}
+	if !near(got.Mean, 100000) {
+		t.Errorf("Mean = %.1f B/s, want 100000", got.Mean)
+	}
+	if !near(got.Peak, 100000) {
+		t.Errorf("Peak = %.1f B/s, want 100000", got.Peak)
+	}
+}
+
+func TestMeterPeakIsBestSlice(t *testing.T) {
+	// Steady 100 kB/s after the warm-up, with one slice of 500 kB/s.
+	var reads []read
+	for _, r := range every(0, 3000*ms, 100*ms, 10000) {
+		if r.at > 2200*ms && r.at <= 2500*ms {
+			r.n = 50000
+		}
+		reads = append(reads, r)
+	}
+	b := &fakeBody{reads: reads}
+
+	got, err := b.meter(10 * time.Second).measure(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !near(got.Mean, (17*10000+3*50000)/2.0) {
+		t.Errorf("Mean = %.1f B/s, want 160000", got.Mean)
+	}
+	if !near(got.Peak, 3*50000/0.3) {
+		t.Errorf("Peak = %.1f B/s, want 500000", got.Peak)
+	}
+}
+
+func TestMeterStopsAtWindow(t *testing.T) {
+	b := &fakeBody{reads: every(0, 5000*ms, 100*ms, 1000)}
+
+	got, err := b.meter(2 * time.Second).measure(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.next != 21 {
+		t.Errorf("read %d times, want to stop at the read 2s in", b.next)
+	}
+	if got.Bytes != 21*1000 || !near(got.Mean, 10000) {
+		t.Errorf("got %+v, want 21000 bytes at 10000 B/s", got)
+	}
+}
+
+func TestMeterShortBody(t *testing.T) {
+	// The body ends before the warm-up, so everything after the first
+	// read counts.
+	reads := every(0, 500*ms, 100*ms, 1000)
+	reads = append(reads, read{at: 500 * ms, err: io.EOF})
+	b := &fakeBody{reads: reads}
+
+	got, err := b.meter(10 * time.Second).measure(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Bytes != 6000 || !near(got.Mean, 10000) || !near(got.Peak, 10000) {
+		t.Errorf("got %+v, want 6000 bytes at 10000 B/s", got)
+	}
+}
+
+func TestMeterSingleRead(t *testing.T) {
+	b := &fakeBody{reads: []read{{at: 0, n: 1000, err: io.EOF}}}
+
+	got, err := b.meter(10 * time.Second).measure(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Bytes != 1000 || got.Mean != 0 || got.Peak != 0 {
+		t.Errorf("got %+v, want 1000 bytes and no rate", got)
+	}
+}
+
+func TestMeterEmptyBody(t *testing.T) {
+	b := &fakeBody{}
+	if _, err := b.meter(10 * time.Second).measure(b); err != errEmptyBody {
+		t.Errorf("err = %v, want %v", err, errEmptyBody)
+	}
+
+	failed := errors.New("connection reset")
+	b = &fakeBody{reads: []read{{at: 100 * ms, err: failed}}}
+	if _, err := b.meter(10 * time.Second).measure(b); err != failed {
+		t.Errorf("err = %v, want %v", err, failed)
+	}
+}
+
+func TestMeterErrorAfterData(t *testing.T) {
+	reads := every(0, 500*ms, 100*ms, 1000)
+	reads = append(reads, read{at: 600 * ms, err: errors.New("connection reset")})
+	b := &fakeBody{reads: reads}
+
+	got, err := b.meter(10 * time.Second).measure(b)
+	if err != nil {
+		t.Fatalf("err = %v, want the data measured so far", err)
+	}
+	if got.Bytes != 6000 || !near(got.Mean, 10000) {
+		t.Errorf("got %+v, want 6000 bytes at 10000 B/s", got)
+	}
+}
+
+func TestMeasureDownloadTTFB(t *testing.T) {
+	const delay = 100 * ms
+	body := strings.Repeat("x", 100000)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		io.WriteString(w, body)
+	}))
+	defer srv.Close()
+
+	got, err := measureDownload(context.Background(), PhaseSpeed, func(ctx context.Context) (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, "GET", srv.URL, nil)
+		if err != nil {
+			return nil, err
+		}
+		return srv.Client().Do(req)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.TTFB < delay || got.TTFB > downloadTimeout {
+		t.Errorf("TTFB = %v, want at least %v", got.TTFB, delay)
+	}
+	if got.Bytes != int64(len(body)) {
+		t.Errorf("Bytes = %d, want %d", got.Bytes, len(body))
+	}
+}
\ No newline at end of file
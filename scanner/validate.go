@@ -0,0 +1,275 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	validateProbeWait = 2 * time.Second
+	lineContextWidth  = 60
+)
+
+// ValidationCheck is the outcome of one step of ValidateXrayConfig. A
+// failed check with Warning set does not make the config unusable.
+type ValidationCheck struct {
+	Name    string
+	Err     error
+	Detail  string
+	Hint    string
+	Warning bool
+}
+
+func (c ValidationCheck) OK() bool {
+	return c.Err == nil
+}
+
+// ValidationFailed reports whether any check failed that makes scanning
+// in Xray mode pointless.
+func ValidationFailed(checks []ValidationCheck) bool {
+	for _, c := range checks {
+		if !c.OK() && !c.Warning {
+			return true
+		}
+	}
+	return false
+}
+
+// lineAt describes the position of offset in data as its line and column
+// and the text around it, shortened for minified configs.
+func lineAt(data []byte, offset int64) string {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	start := bytes.LastIndexByte(before, '\n') + 1
+	end := bytes.IndexByte(data[start:], '\n')
+	if end < 0 {
+		end = len(data) - start
+	}
+	text := string(data[start : start+end])
+	col := int(offset) - start + 1
+	if len(text) > lineContextWidth {
+		from := col - lineContextWidth/2
+		if from < 0 {
+			from = 0
+		}
+		to := from + lineContextWidth
+		if to > len(text) {
+			to = len(text)
+		}
+		text = "..." + text[from:to] + "..."
+	}
+	return fmt.Sprintf("line %d, column %d: %s", line, col, strings.TrimSpace(text))
+}
+
+// findLine locates the first match of pattern in data and describes its
+// line, or returns "" if there is none.
+func findLine(data []byte, pattern string) string {
+	loc := regexp.MustCompile(pattern).FindIndex(data)
+	if loc == nil {
+		return ""
+	}
+	return lineAt(data, int64(loc[0]))
+}
+
+func jsonErrorDetail(data []byte, err error) string {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var offset int64
+	switch {
+	case errors.As(err, &syntaxErr):
+		offset = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		offset = typeErr.Offset
+	default:
+		return ""
+	}
+	return lineAt(data, offset)
+}
+
+// ValidateXrayConfig checks config/xray_config.json step by step: that it
+// parses, has a SOCKS inbound and a usable proxy outbound, that the probe
+// targets are valid URLs, that it passes "xray run -test", and, with probe
+// set, that a request gets through the proxy at its original address.
+// Checking stops at the first step that later ones depend on.
+func ValidateXrayConfig(probe bool) []ValidationCheck {
+	var checks []ValidationCheck
+	add := func(c ValidationCheck) bool {
+		checks = append(checks, c)
+		return c.OK() || c.Warning
+	}
+
+	data, err := os.ReadFile(xrayConfigPath)
+	if !add(ValidationCheck{Name: "Config file", Err: err, Detail: xrayConfigPath,
+		Hint: "Copy the sample config to config/xray_config.json and fill in your server."}) {
+		return checks
+	}
+
+	var cfg map[string]interface{}
+	err = json.Unmarshal(data, &cfg)
+	if !add(ValidationCheck{Name: "JSON syntax", Err: err, Detail: jsonErrorDetail(data, err),
+		Hint: "Look for a missing comma or quote, or a trailing comma, on or just before that line."}) {
+		return checks
+	}
+
+	socks := ValidationCheck{Name: "SOCKS inbound", Detail: findLine(data, `"protocol"\s*:\s*"socks"`)}
+	inbounds, _ := cfg["inbounds"].([]interface{})
+	found := false
+	for _, in := range inbounds {
+		if inMap, ok := in.(map[string]interface{}); ok && strings.EqualFold(stringField(inMap, "protocol"), "socks") {
+			found = true
+			break
+		}
+	}
+	if !found {
+		socks.Err = fmt.Errorf("no SOCKS inbound found in config")
+		socks.Detail = findLine(data, `"inbounds"`)
+		socks.Hint = `Add {"protocol": "socks", "listen": "127.0.0.1", "port": 10808, "settings": {"auth": "noauth"}} to "inbounds".`
+	}
+	if !add(socks) {
+		return checks
+	}
+
+	outCheck := ValidationCheck{Name: "Proxy outbound"}
+	proxyOutbound, _, err := findProxyOutbound(cfg)
+	if err != nil {
+		outCheck.Err = err
+		outCheck.Detail = findLine(data, `"outbounds"`)
+		outCheck.Hint = "Add the outbound of your server (vless, vmess, trojan, shadowsocks, ...) before any freedom or blackhole outbound."
+	} else {
+		protocol := stringField(proxyOutbound, "protocol")
+		outCheck.Detail = findLine(data, `"protocol"\s*:\s*"`+regexp.QuoteMeta(protocol)+`"`)
+		clone, _ := cloneOutbound(proxyOutbound)
+		if _, err := setOutboundAddress(clone, "127.0.0.1", xrayPort); err != nil {
+			outCheck.Err = err
+			outCheck.Hint = "Supported protocols are vless, vmess, trojan, shadowsocks, http, socks, hysteria and wireguard."
+		}
+	}
+	if !add(outCheck) {
+		return checks
+	}
+
+	if _, _, _, err := buildTempConfig("", xrayPortBase, nil); !add(ValidationCheck{Name: "Test config", Err: err,
+		Hint: "Every outbound named in proxySettings or sockopt.dialerProxy must exist in the config."}) {
+		return checks
+	}
+
+	if !add(ValidationCheck{Name: "Probe targets", Err: ValidateProbeConfig(opts.Probe),
+		Hint: `Fix the URL under "probe" in settings.json.`}) {
+		return checks
+	}
+
+	testCheck := ValidationCheck{Name: "xray run -test"}
+	out, err := exec.Command(xrayBinaryPath, "run", "-test", "-c", xrayConfigPath).CombinedOutput()
+	if err != nil {
+		testCheck.Err = err
+		testCheck.Detail = lastLines(string(out), 3)
+		testCheck.Hint = "Xray itself rejects the config; the message above names the offending field."
+	}
+	if !add(testCheck) || !probe {
+		return checks
+	}
+
+	latency, url, err := probeOriginalAddress()
+	probeCheck := ValidationCheck{Name: "End-to-end probe", Err: err, Warning: true}
+	if err != nil {
+		probeCheck.Hint = "The server is not reachable at its original address. This is normal if that address is blocked; otherwise check the UUID, path and SNI."
+	} else {
+		probeCheck.Detail = fmt.Sprintf("%s answered in %dms", url, latency.Milliseconds())
+	}
+	add(probeCheck)
+	return checks
+}
+
+func lastLines(s string, n int) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// probeOriginalAddress starts Xray with the test config, keeping the
+// server address from the user's config, and requests the latency targets
+// through it. It returns the target that answered.
+func probeOriginalAddress() (time.Duration, string, error) {
+	socksPort := xrayPortBase + xrayWorkerCount + 1
+	cleanCfg, socksInfo, _, err := buildTempConfig("", socksPort, nil)
+	if err != nil {
+		return 0, "", err
+	}
+	// Scans keep Xray quiet, but here its warnings explain why it exited.
+	cleanCfg["log"] = map[string]interface{}{"loglevel": "warning"}
+	configPath, err := writeTempConfig(cleanCfg)
+	if err != nil {
+		return 0, "", err
+	}
+	defer os.Remove(configPath)
+
+	var output bytes.Buffer
+	cmd := exec.Command(xrayBinaryPath, "run", "-c", configPath)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Start(); err != nil {
+		return 0, "", fmt.Errorf("cannot start xray: %v", err)
+	}
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+	defer func() {
+		cmd.Process.Kill()
+		<-exited
+	}()
+
+	select {
+	case <-exited:
+		return 0, "", fmt.Errorf("xray exited: %s", lastLines(output.String(), 3))
+	case <-time.After(xrayStartupDelay):
+	}
+
+	dialer, err := createSocksDialer(socksInfo)
+	if err != nil {
+		return 0, "", err
+	}
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return dialer.Dial(network, addr)
+			},
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			DisableKeepAlives: true,
+		},
+		Timeout: xrayPingTimeout + validateProbeWait,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	var latency time.Duration
+	var url string
+	targets := &targetList{targets: latencyTargets()}
+	err = targets.try(func(t ProbeTarget) error {
+		start := time.Now()
+		if err := t.check(context.Background(), client); err != nil {
+			return err
+		}
+		latency, url = time.Since(start), t.URL
+		return nil
+	})
+	return latency, url, err
+}
\ No newline at end of file
@@ -10,30 +10,23 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
-	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/VividCortex/ewma"
 	"github.com/fatih/color"
 	"golang.org/x/net/proxy"
 )
 
 const (
-	xrayBufferSize      = 1024
-	xrayDownloadURL     = "https://speed.cloudflare.com/__down?bytes=52428800"
-	xrayDownloadTimeout = 10 * time.Second
-	xrayTestNum         = 10
-	xrayMinSpeed        = 0.0
-	xrayPort            = 443
-	xrayWorkerCount     = 8
-	xrayStartupDelay    = 350 * time.Millisecond
-	xrayPortBase        = 11080
-	xrayPingTimes       = 3
-	xrayPingTimeout     = 3 * time.Second
-	xrayPingInterval    = 50 * time.Millisecond
+	xrayPort         = 443
+	xrayWorkerCount  = 8
+	xrayStartupDelay = 350 * time.Millisecond
+	xrayPortBase     = 11080
+	xrayPingTimeout  = 3 * time.Second
+	xrayConfigPath   = "./config/xray_config.json"
+	xrayBinaryPath   = "./xray/xray"
 )
 
 type xraySocksInfo struct {
@@ -56,6 +49,7 @@ var allowedStreamFields = map[string]bool{
 	"dsSettings":          true,
 	"httpupgradeSettings": true,
 	"splithttpSettings":   true,
+	"xhttpSettings":       true,
 	"sockopt":             true,
 }
 
@@ -82,27 +76,83 @@ func getDialerProxy(outMap map[string]interface{}) string {
 	return dp
 }
 
-func createTempConfigWithIP(ip string, socksPort int) (string, *xraySocksInfo, error) {
-	data, err := os.ReadFile("./config/xray_config.json")
+func readXrayConfig() (map[string]interface{}, error) {
+	data, err := os.ReadFile(xrayConfigPath)
 	if err != nil {
-		return "", nil, fmt.Errorf("cannot read config: %v", err)
+		return nil, fmt.Errorf("cannot read config: %v", err)
 	}
 
 	var cfg map[string]interface{}
 	if err := json.Unmarshal(data, &cfg); err != nil {
-		return "", nil, fmt.Errorf("invalid JSON in config: %v", err)
+		return nil, fmt.Errorf("invalid JSON in config: %v", err)
+	}
+	return cfg, nil
+}
+
+func findProxyOutbound(cfg map[string]interface{}) (map[string]interface{}, map[string]map[string]interface{}, error) {
+	outboundsRaw, ok := cfg["outbounds"]
+	if !ok {
+		return nil, nil, fmt.Errorf("no 'outbounds' field in config")
+	}
+	outboundsSlice, ok := outboundsRaw.([]interface{})
+	if !ok {
+		return nil, nil, fmt.Errorf("'outbounds' is not an array")
+	}
+
+	skipProtocols := map[string]bool{
+		"freedom":   true,
+		"blackhole": true,
+		"dns":       true,
+		"loopback":  true,
+	}
+
+	var proxyOutbound map[string]interface{}
+	outboundsByTag := make(map[string]map[string]interface{})
+
+	for _, out := range outboundsSlice {
+		outMap, ok := out.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		tag, _ := outMap["tag"].(string)
+		if tag != "" {
+			outboundsByTag[tag] = outMap
+		}
+		protocol, _ := outMap["protocol"].(string)
+		protocol = strings.ToLower(protocol)
+		if !skipProtocols[protocol] && proxyOutbound == nil {
+			proxyOutbound = outMap
+		}
+	}
+
+	if proxyOutbound == nil {
+		return nil, nil, fmt.Errorf("no supported proxy outbound found in config")
+	}
+	return proxyOutbound, outboundsByTag, nil
+}
+
+// buildTempConfig derives a minimal config that sends everything through
+// the proxy outbound pointed at ip, or at its original address if ip is
+// empty, together with the outbounds it chains to. A non-nil fragment
+// replaces the fragment settings of the freedom outbound at the end of
+// the dialer chain, adding one if there is none. changes describes how
+// the result differs from the user's config.
+func buildTempConfig(ip string, socksPort int, fragment map[string]interface{}) (cleanCfg map[string]interface{}, socksInfo *xraySocksInfo, changes []string, err error) {
+	cfg, err := readXrayConfig()
+	if err != nil {
+		return nil, nil, nil, err
 	}
 
 	inboundsRaw, ok := cfg["inbounds"]
 	if !ok {
-		return "", nil, fmt.Errorf("no 'inbounds' field in config")
+		return nil, nil, nil, fmt.Errorf("no 'inbounds' field in config")
 	}
 	inboundsSlice, ok := inboundsRaw.([]interface{})
 	if !ok {
-		return "", nil, fmt.Errorf("'inbounds' is not an array")
+		return nil, nil, nil, fmt.Errorf("'inbounds' is not an array")
 	}
 
-	socksInfo := &xraySocksInfo{Address: "127.0.0.1", Port: socksPort}
+	socksInfo = &xraySocksInfo{Address: "127.0.0.1", Port: socksPort}
 	var newInbounds []interface{}
 
 	for _, in := range inboundsSlice {
@@ -160,152 +210,82 @@ func createTempConfigWithIP(ip string, socksPort int) (string, *xraySocksInfo, e
 	}
 
 	if len(newInbounds) == 0 {
-		return "", nil, fmt.Errorf("no SOCKS inbound found in config")
-	}
-
-	outboundsRaw, ok := cfg["outbounds"]
-	if !ok {
-		return "", nil, fmt.Errorf("no 'outbounds' field in config")
-	}
-	outboundsSlice, ok := outboundsRaw.([]interface{})
-	if !ok {
-		return "", nil, fmt.Errorf("'outbounds' is not an array")
+		return nil, nil, nil, fmt.Errorf("no SOCKS inbound found in config")
 	}
+	changes = append(changes, "inbounds: only the first SOCKS inbound is kept, on a local test port")
 
-	skipProtocols := map[string]bool{
-		"freedom":   true,
-		"blackhole": true,
-		"dns":       true,
+	proxyOutbound, outboundsByTag, err := findProxyOutbound(cfg)
+	if err != nil {
+		return nil, nil, nil, err
 	}
 
-	var proxyOutbound map[string]interface{}
-	outboundsByTag := make(map[string]map[string]interface{})
-
-	for _, out := range outboundsSlice {
-		outMap, ok := out.(map[string]interface{})
-		if !ok {
-			continue
-		}
-		tag, _ := outMap["tag"].(string)
-		if tag != "" {
-			outboundsByTag[tag] = outMap
+	if ip == "" {
+		changes = append(changes, "proxy outbound: original address kept")
+	} else {
+		addrChanges, err := setOutboundAddress(proxyOutbound, ip, xrayPort)
+		if err != nil {
+			return nil, nil, nil, err
 		}
-		protocol, _ := outMap["protocol"].(string)
-		protocol = strings.ToLower(protocol)
-		if !skipProtocols[protocol] && proxyOutbound == nil {
-			proxyOutbound = outMap
+		for _, c := range addrChanges {
+			changes = append(changes, "proxy outbound: "+c)
 		}
 	}
-
-	if proxyOutbound == nil {
-		return "", nil, fmt.Errorf("no supported proxy outbound found in config")
-	}
-
-	protocol, _ := proxyOutbound["protocol"].(string)
-	protocol = strings.ToLower(protocol)
-
-	settings, ok := proxyOutbound["settings"].(map[string]interface{})
-	if !ok {
-		return "", nil, fmt.Errorf("proxy outbound has no 'settings' field")
+	cleanedProxy, dropped := cleanOutbound(proxyOutbound, "proxy")
+	if len(dropped) > 0 {
+		changes = append(changes, "proxy outbound: dropped "+strings.Join(dropped, ", "))
 	}
 
-	ipUpdated := false
-	switch protocol {
-	case "vless", "vmess":
-		vnextRaw, ok := settings["vnext"]
-		if !ok {
-			return "", nil, fmt.Errorf("vless/vmess outbound missing 'vnext'")
-		}
-		vnextSlice, ok := vnextRaw.([]interface{})
-		if !ok || len(vnextSlice) == 0 {
-			return "", nil, fmt.Errorf("vless/vmess 'vnext' is empty")
-		}
-		server, ok := vnextSlice[0].(map[string]interface{})
-		if !ok {
-			return "", nil, fmt.Errorf("vless/vmess server entry is invalid")
-		}
-		server["address"] = ip
-		server["port"] = float64(xrayPort)
-		vnextSlice[0] = server
-		settings["vnext"] = vnextSlice
-		ipUpdated = true
-
-	case "trojan", "shadowsocks":
-		serversRaw, ok := settings["servers"]
-		if !ok {
-			return "", nil, fmt.Errorf("trojan/shadowsocks outbound missing 'servers'")
-		}
-		serversSlice, ok := serversRaw.([]interface{})
-		if !ok || len(serversSlice) == 0 {
-			return "", nil, fmt.Errorf("trojan/shadowsocks 'servers' is empty")
+	// Outbounds the proxy dials through, directly or via another chained
+	// outbound, are carried over under their own tags.
+	newOutbounds := []interface{}{cleanedProxy}
+	taken := map[string]bool{"proxy": true}
+	queue := chainedTags(cleanedProxy)
+	for len(queue) > 0 {
+		tag, field := queue[0][0], queue[0][1]
+		queue = queue[1:]
+		if taken[tag] {
+			continue
 		}
-		server, ok := serversSlice[0].(map[string]interface{})
-		if !ok {
-			return "", nil, fmt.Errorf("trojan/shadowsocks server entry is invalid")
+		refOut, found := outboundsByTag[tag]
+		if !found {
+			return nil, nil, nil, fmt.Errorf("outbound %q used by %s is not in the config", tag, field)
 		}
-		server["address"] = ip
-		server["port"] = float64(xrayPort)
-		serversSlice[0] = server
-		settings["servers"] = serversSlice
-		ipUpdated = true
-	}
-
-	if !ipUpdated {
-		return "", nil, fmt.Errorf("unsupported proxy protocol: %s", protocol)
-	}
-
-	cleanedProxy := map[string]interface{}{
-		"protocol": proxyOutbound["protocol"],
-		"settings": settings,
-		"tag":      "proxy",
-	}
-
-	var dialerProxyTag string
-	if ss, ok := proxyOutbound["streamSettings"].(map[string]interface{}); ok {
-		cleanedSS := cleanStreamSettings(ss)
-		cleanedProxy["streamSettings"] = cleanedSS
-		dialerProxyTag = getDialerProxy(cleanedProxy)
-	}
-
-	if mux, ok := proxyOutbound["mux"].(map[string]interface{}); ok {
-		if enabled, _ := mux["enabled"].(bool); !enabled {
-			cleanedProxy["mux"] = map[string]interface{}{"enabled": false}
+		cleanRef, dropped := cleanOutbound(refOut, tag)
+		changes = append(changes, fmt.Sprintf("outbound %q: kept, used by %s", tag, field))
+		if len(dropped) > 0 {
+			changes = append(changes, fmt.Sprintf("outbound %q: dropped %s", tag, strings.Join(dropped, ", ")))
 		}
+		newOutbounds = append(newOutbounds, cleanRef)
+		taken[tag] = true
+		queue = append(queue, chainedTags(cleanRef)...)
 	}
 
-	newOutbounds := []interface{}{
-		cleanedProxy,
-		map[string]interface{}{
+	if !taken["direct"] {
+		newOutbounds = append(newOutbounds, map[string]interface{}{
 			"protocol": "freedom",
 			"settings": map[string]interface{}{},
 			"tag":      "direct",
-		},
-		map[string]interface{}{
+		})
+	}
+	if !taken["block"] {
+		newOutbounds = append(newOutbounds, map[string]interface{}{
 			"protocol": "blackhole",
 			"settings": map[string]interface{}{
 				"response": map[string]interface{}{"type": "http"},
 			},
 			"tag": "block",
-		},
+		})
 	}
+	changes = append(changes, "routing, dns and other outbounds: replaced by one rule sending all traffic to the proxy")
 
-	if dialerProxyTag != "" {
-		if refOut, found := outboundsByTag[dialerProxyTag]; found {
-			cleanRef := map[string]interface{}{
-				"protocol": refOut["protocol"],
-				"tag":      dialerProxyTag,
-			}
-			if refSettings, ok := refOut["settings"].(map[string]interface{}); ok {
-				cleanRef["settings"] = refSettings
-			}
-			if refSS, ok := refOut["streamSettings"].(map[string]interface{}); ok {
-				cleanRef["streamSettings"] = cleanStreamSettings(refSS)
-			}
-			newOutbounds = append(newOutbounds, cleanRef)
+	if fragment != nil {
+		newOutbounds, err = withFragment(cleanedProxy, newOutbounds, fragment)
+		if err != nil {
+			return nil, nil, nil, err
 		}
 	}
 
-	cleanCfg := map[string]interface{}{
+	cleanCfg = map[string]interface{}{
 		"log": map[string]interface{}{
 			"loglevel": "none",
 		},
@@ -323,23 +303,41 @@ func createTempConfigWithIP(ip string, socksPort int) (string, *xraySocksInfo, e
 		},
 	}
 
+	return cleanCfg, socksInfo, changes, nil
+}
+
+// createTempConfigWithIP writes the config from buildTempConfig to a
+// temporary file and returns its path.
+func createTempConfigWithIP(ip string, socksPort int, fragment map[string]interface{}) (string, *xraySocksInfo, error) {
+	cleanCfg, socksInfo, _, err := buildTempConfig(ip, socksPort, fragment)
+	if err != nil {
+		return "", nil, err
+	}
+	path, err := writeTempConfig(cleanCfg)
+	if err != nil {
+		return "", nil, err
+	}
+	return path, socksInfo, nil
+}
+
+func writeTempConfig(cleanCfg map[string]interface{}) (string, error) {
 	newData, err := json.MarshalIndent(cleanCfg, "", "  ")
 	if err != nil {
-		return "", nil, fmt.Errorf("failed to marshal config: %v", err)
+		return "", fmt.Errorf("failed to marshal config: %v", err)
 	}
 
 	tempFile, err := os.CreateTemp("", "xray_cfg_*.json")
 	if err != nil {
-		return "", nil, fmt.Errorf("failed to create temp file: %v", err)
+		return "", fmt.Errorf("failed to create temp file: %v", err)
 	}
 	if _, err := tempFile.Write(newData); err != nil {
 		tempFile.Close()
 		os.Remove(tempFile.Name())
-		return "", nil, fmt.Errorf("failed to write temp config: %v", err)
+		return "", fmt.Errorf("failed to write temp config: %v", err)
 	}
 	tempFile.Close()
 
-	return tempFile.Name(), socksInfo, nil
+	return tempFile.Name(), nil
 }
 
 func createSocksDialer(socksInfo *xraySocksInfo) (proxy.Dialer, error) {
@@ -351,19 +349,28 @@ func createSocksDialer(socksInfo *xraySocksInfo) (proxy.Dialer, error) {
 	return proxy.SOCKS5("tcp", addr, nil, proxy.Direct)
 }
 
-func testIPViaXray(ip *net.IPAddr, socksPort int) (recv int, totalDelay time.Duration) {
-	configPath, socksInfo, err := createTempConfigWithIP(ip.String(), socksPort)
+// testIPViaXray sends the configured rounds of requests to the latency
+// targets through Xray with the proxy pointed at ip. It returns how many
+// were sent, the latency of the ones that succeeded and the reasons the
+// others, or Xray itself, failed.
+func testIPViaXray(ip *net.IPAddr, socksPort int, fragment map[string]interface{}) (sent int, samples []time.Duration, failures FailureCounts) {
+	configPath, socksInfo, err := createTempConfigWithIP(ip.String(), socksPort, fragment)
 	if err != nil {
+		emitXrayStart(PhaseXrayPing, ip, err)
+		failures = failures.add(failWith(FailureXrayStart, err))
 		return
 	}
 	defer os.Remove(configPath)
 
-	cmd := exec.Command("./xray/xray", "run", "-c", configPath)
+	cmd := exec.Command(xrayBinaryPath, "run", "-c", configPath)
 	cmd.Stdout = io.Discard
 	cmd.Stderr = io.Discard
 	if err := cmd.Start(); err != nil {
+		emitXrayStart(PhaseXrayPing, ip, err)
+		failures = failures.add(failWith(FailureXrayStart, err))
 		return
 	}
+	emitXrayStart(PhaseXrayPing, ip, nil)
 	defer func() {
 		cmd.Process.Kill()
 		cmd.Wait()
@@ -373,48 +380,51 @@ func testIPViaXray(ip *net.IPAddr, socksPort int) (recv int, totalDelay time.Dur
 
 	dialer, err := createSocksDialer(socksInfo)
 	if err != nil {
+		failures = failures.add(failWith(FailureSOCKS, err))
 		return
 	}
 
 	httpClient := &http.Client{
 		Transport: &http.Transport{
 			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				if !throttle(ctx.Done(), PhaseXrayPing) {
+					return nil, ctx.Err()
+				}
 				return dialer.Dial(network, addr)
 			},
 			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
 			DisableKeepAlives: true,
 		},
-		Timeout: xrayPingTimeout,
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			return http.ErrUseLastResponse
 		},
 	}
 
-	for i := 0; i < xrayPingTimes; i++ {
-		start := time.Now()
-		resp, err := httpClient.Get("https://cp.cloudflare.com/generate_204")
-		if err == nil {
-			io.Copy(io.Discard, resp.Body)
-			resp.Body.Close()
-			if resp.StatusCode == 200 || resp.StatusCode == 204 {
-				recv++
-				totalDelay += time.Since(start)
+	targets := &targetList{targets: latencyTargets()}
+	return opts.Ping.XrayRounds.run(xrayPingTimeout, func(timeout time.Duration) (time.Duration, error) {
+		var d time.Duration
+		err := targets.try(func(t ProbeTarget) error {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			start := time.Now()
+			if err := t.check(ctx, httpClient); err != nil {
+				return err
 			}
-		}
-		if i < xrayPingTimes-1 {
-			time.Sleep(xrayPingInterval)
-		}
-	}
-	return
+			d = time.Since(start)
+			return nil
+		})
+		emitProbe(PhaseXrayPing, ip, d, err)
+		return d, err
+	})
 }
 
 func PingIPsViaXray(stopCh <-chan struct{}, ips []*net.IPAddr) []PingResult {
-	if _, err := os.Stat("./xray/xray"); os.IsNotExist(err) {
-		color.New(color.FgRed).Println("ERROR: Xray binary not found at ./xray/xray")
+	if _, err := os.Stat(xrayBinaryPath); os.IsNotExist(err) {
+		color.New(color.FgRed).Printf("ERROR: Xray binary not found at %s\n", xrayBinaryPath)
 		return nil
 	}
-	if _, err := os.Stat("./config/xray_config.json"); os.IsNotExist(err) {
-		color.New(color.FgRed).Println("ERROR: Xray config not found at ./config/xray_config.json")
+	if _, err := os.Stat(xrayConfigPath); os.IsNotExist(err) {
+		color.New(color.FgRed).Printf("ERROR: Xray config not found at %s\n", xrayConfigPath)
 		return nil
 	}
 
@@ -422,8 +432,9 @@ func PingIPsViaXray(stopCh <-chan struct{}, ips []*net.IPAddr) []PingResult {
 	var mu sync.Mutex
 	total := len(ips)
 
-	color.New(color.FgCyan).Printf("Start latency test (Xray mode - %d attempts per IP, %d workers)\n", xrayPingTimes, xrayWorkerCount)
+	color.New(color.FgCyan).Printf("Start latency test (Xray mode - up to %d attempts per IP, %d workers)\n", opts.Ping.XrayRounds.rounds(), xrayWorkerCount)
 	bar := newBar(total, "Available:", "")
+	emitPhaseStart(PhaseXrayPing, total)
 
 	ipChan := make(chan *net.IPAddr, total)
 	for _, ip := range ips {
@@ -449,19 +460,19 @@ func PingIPsViaXray(stopCh <-chan struct{}, ips []*net.IPAddr) []PingResult {
 				default:
 				}
 
-				recv, totalDelay := testIPViaXray(ipAddr, socksPort)
+				sent, samples, failures := testIPViaXray(ipAddr, socksPort, nil)
 
 				mu.Lock()
 				nowAble := len(results)
-				if recv > 0 {
+				if len(samples) > 0 {
 					nowAble++
-					avgDelay := totalDelay / time.Duration(recv)
-					results = append(results, PingResult{
-						IP:       ipAddr,
-						Sended:   xrayPingTimes,
-						Received: recv,
-						Delay:    avgDelay,
-					})
+					pr := newPingResult(ipAddr, sent, samples)
+					pr.Failures = failures
+					results = append(results, pr)
+					r := NewIPResult(pr, 0)
+					emitIPDone(PhaseXrayPing, ipAddr, &r)
+				} else {
+					emitIPDone(PhaseXrayPing, ipAddr, nil)
 				}
 				bar.grow(1, strconv.Itoa(nowAble))
 				mu.Unlock()
@@ -471,33 +482,36 @@ func PingIPsViaXray(stopCh <-chan struct{}, ips []*net.IPAddr) []PingResult {
 
 	wg.Wait()
 	bar.done()
+	emitPhaseEnd(PhaseXrayPing)
 
-	sort.Slice(results, func(i, j int) bool {
-		li, lj := results[i].GetLossRate(), results[j].GetLossRate()
-		if li != lj {
-			return li < lj
-		}
-		return results[i].Delay < results[j].Delay
-	})
+	results = filterPingResults(results)
+	sortPingResults(results)
 
-	fmt.Println()
+	fmt.Fprintln(output)
 	color.New(color.FgGreen).Printf("Latency test completed (Xray): %d responsive IPs found\n\n", len(results))
+	printFailureSummary(PhaseXrayPing)
 	return results
 }
 
-func downloadSpeedViaXray(ip *net.IPAddr, socksPort int) float64 {
-	configPath, socksInfo, err := createTempConfigWithIP(ip.String(), socksPort)
+// downloadSpeedViaXray measures the download from the speed URL, or from
+// the first fallback that answers, through Xray with the proxy pointed at
+// ip. The error is set when the download could not be started at all.
+func downloadSpeedViaXray(ctx context.Context, ip *net.IPAddr, socksPort int, fragment map[string]interface{}) (Throughput, error) {
+	configPath, socksInfo, err := createTempConfigWithIP(ip.String(), socksPort, fragment)
 	if err != nil {
-		return 0.0
+		emitXrayStart(PhaseXraySpeed, ip, err)
+		return Throughput{}, failWith(FailureXrayStart, err)
 	}
 	defer os.Remove(configPath)
 
-	cmd := exec.Command("./xray/xray", "run", "-c", configPath)
+	cmd := exec.Command(xrayBinaryPath, "run", "-c", configPath)
 	cmd.Stdout = io.Discard
 	cmd.Stderr = io.Discard
 	if err := cmd.Start(); err != nil {
-		return 0.0
+		emitXrayStart(PhaseXraySpeed, ip, err)
+		return Throughput{}, failWith(FailureXrayStart, err)
 	}
+	emitXrayStart(PhaseXraySpeed, ip, nil)
 	defer func() {
 		cmd.Process.Kill()
 		cmd.Wait()
@@ -507,135 +521,97 @@ func downloadSpeedViaXray(ip *net.IPAddr, socksPort int) float64 {
 
 	dialer, err := createSocksDialer(socksInfo)
 	if err != nil {
-		return 0.0
+		return Throughput{}, failWith(FailureSOCKS, err)
 	}
 
 	httpClient := &http.Client{
 		Transport: &http.Transport{
 			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				if !throttle(ctx.Done(), PhaseXraySpeed) {
+					return nil, ctx.Err()
+				}
 				return dialer.Dial(network, addr)
 			},
 			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
 			DisableKeepAlives: true,
 		},
-		Timeout: xrayDownloadTimeout,
 	}
 
-	req, err := http.NewRequest("GET", xrayDownloadURL, nil)
-	if err != nil {
-		return 0.0
-	}
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_12_6) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/98.0.4758.80 Safari/537.36")
-
-	response, err := httpClient.Do(req)
-	if err != nil {
-		return 0.0
-	}
-	defer response.Body.Close()
-
-	if response.StatusCode != 200 {
-		return 0.0
-	}
-
-	timeStart := time.Now()
-	timeEnd := timeStart.Add(xrayDownloadTimeout)
-	buffer := make([]byte, xrayBufferSize)
-	var contentRead int64 = 0
-	var lastContentRead int64 = 0
-	timeSlice := xrayDownloadTimeout / 100
-	timeCounter := 1
-	nextTime := timeStart.Add(timeSlice * time.Duration(timeCounter))
-	e := ewma.NewMovingAverage()
-
-	for {
-		currentTime := time.Now()
-		if currentTime.After(nextTime) {
-			timeCounter++
-			nextTime = timeStart.Add(timeSlice * time.Duration(timeCounter))
-			e.Add(float64(contentRead - lastContentRead))
-			lastContentRead = contentRead
-		}
-		if currentTime.After(timeEnd) {
-			break
-		}
-		n, err := response.Body.Read(buffer)
-		if err != nil {
-			if err != io.EOF {
-				break
-			}
-			if response.ContentLength == -1 {
-				break
-			}
-			lastSlice := timeStart.Add(timeSlice * time.Duration(timeCounter-1))
-			if currentTime.After(lastSlice) {
-				ratio := float64(currentTime.Sub(lastSlice)) / float64(timeSlice)
-				if ratio > 0 {
-					e.Add(float64(contentRead-lastContentRead) / ratio)
-				}
-			}
-			break
-		}
-		contentRead += int64(n)
-	}
-
-	avgBytesPerSec := e.Value() * 100 / xrayDownloadTimeout.Seconds()
-	return avgBytesPerSec / (1024 * 1024)
+	targets := &targetList{targets: speedTargets()}
+	return measureDownload(ctx, PhaseXraySpeed, func(ctx context.Context) (*http.Response, error) {
+		var response *http.Response
+		err := targets.try(func(t ProbeTarget) error {
+			var err error
+			response, err = t.get(ctx, httpClient)
+			return err
+		})
+		return response, err
+	})
 }
 
 func SpeedTestViaXray(stopCh <-chan struct{}, pingResults []PingResult) []IPResult {
-	testCount := xrayTestNum
-	testNum := testCount
-	if len(pingResults) < testCount {
-		testNum = len(pingResults)
-		testCount = testNum
-	}
+	return SpeedTestViaXrayWith(stopCh, pingResults, opts.Speed)
+}
+
+// SpeedTestViaXrayWith is SpeedTestViaXray with the Wanted and MaxTest of
+// c instead of the configured ones.
+func SpeedTestViaXrayWith(stopCh <-chan struct{}, pingResults []PingResult, c SpeedConfig) []IPResult {
+	wanted, maxTest := c.queue(len(pingResults))
 
 	barPadding := "     "
 	for i := 0; i < len(strconv.Itoa(len(pingResults))); i++ {
 		barPadding += " "
 	}
 
-	color.New(color.FgCyan).Printf("Start download speed test (Xray mode, Minimum speed: %.2f MB/s, Number: %d, Queue: %d)\n", xrayMinSpeed, testCount, testNum)
-	bar := newBar(testCount, barPadding, "")
+	if url := opts.Speed.downloadURL(); url != downloadURL {
+		color.New(color.FgCyan).Printf("Speed test URL: %s\n", url)
+	}
+	color.New(color.FgCyan).Printf("Start download speed test (Xray mode, Minimum speed: %.2f MB/s, Wanted: %d, Max to test: %d of %d)\n", opts.Scoring.Filters.MinSpeed, wanted, maxTest, len(pingResults))
+	bar := newBar(wanted, barPadding, "")
+	emitPhaseStart(PhaseXraySpeed, maxTest)
 
 	var results []IPResult
 	speedPort := xrayPortBase + xrayWorkerCount
 
-	for i := 0; i < testNum; i++ {
+	for i := 0; i < maxTest; i++ {
 		select {
 		case <-stopCh:
 			goto done
 		default:
 		}
+		bar.setExtra(fmt.Sprintf("tested %d/%d", i+1, maxTest))
 
 		pr := pingResults[i]
-		speedMBps := downloadSpeedViaXray(pr.IP, speedPort)
+		ctx, cancel := skippableContext()
+		t, err := downloadSpeedViaXray(ctx, pr.IP, speedPort, nil)
+		skipped := ctx.Err() != nil
+		cancel()
+		// Start failures were already reported by emitXrayStart.
+		if !skipped && (err == nil || ClassifyError(err) != FailureXrayStart) {
+			emitProbe(PhaseXraySpeed, pr.IP, 0, err)
+		}
 
-		if speedMBps >= xrayMinSpeed {
+		if !skipped && fastEnough(t, err) {
 			bar.grow(1, "")
-			results = append(results, IPResult{
-				IP:            pr.IP,
-				Sended:        pr.Sended,
-				Received:      pr.Received,
-				LossRate:      pr.GetLossRate(),
-				Delay:         int(pr.Delay.Milliseconds()),
-				DownloadSpeed: speedMBps * 1024 * 1024,
-			})
-			if len(results) == testCount {
+			r := NewIPResult(pr, t.Mean)
+			r.PeakSpeed, r.TTFB = t.Peak, int(t.TTFB.Milliseconds())
+			results = append(results, r)
+			emitIPDone(PhaseXraySpeed, pr.IP, &r)
+			if len(results) == wanted {
 				break
 			}
+		} else {
+			emitIPDone(PhaseXraySpeed, pr.IP, nil)
 		}
 	}
 
 done:
 	bar.done()
-	if len(results) > 0 {
-		sort.Slice(results, func(i, j int) bool {
-			return results[i].DownloadSpeed > results[j].DownloadSpeed
-		})
-	}
+	emitPhaseEnd(PhaseXraySpeed)
+	SortResults(results)
 
-	fmt.Println()
+	fmt.Fprintln(output)
 	color.New(color.FgGreen).Printf("Speed test completed (Xray): %d clean IPs found\n\n", len(results))
+	printFailureSummary(PhaseXraySpeed)
 	return results
 }
\ No newline at end of file
@@ -0,0 +1,67 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func at(s string) time.Time {
+	t, err := time.Parse("2006-01-02 15:04", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestParseNext(t *testing.T) {
+	for _, tc := range []struct {
+		expr, from, want string
+	}{
+		{"*/5 * * * *", "2024-05-01 12:03", "2024-05-01 12:05"},
+		{"30 */6 * * *", "2024-05-01 12:30", "2024-05-01 18:30"},
+		{"0 12 * * *", "2024-05-01 12:00", "2024-05-02 12:00"},
+		{"@daily", "2024-05-01 10:00", "2024-05-02 00:00"},
+		{"@hourly", "2024-05-01 23:59", "2024-05-02 00:00"},
+		{"0 0 * * 7", "2024-05-01 00:00", "2024-05-05 00:00"},
+		{"0 0 * * 1-5", "2024-05-03 12:00", "2024-05-06 00:00"},
+		{"0 0 29 2 *", "2024-03-01 00:00", "2028-02-29 00:00"},
+		{"15,45 8 1 */3 *", "2024-05-01 00:00", "2024-07-01 08:15"},
+		{"@every 90m", "2024-05-01 12:00", "2024-05-01 13:30"},
+		// A restricted day of month and day of week match when either
+		// does: the 13th, or any Friday.
+		{"0 0 13 * 5", "2024-05-01 00:00", "2024-05-03 00:00"},
+		{"0 0 13 * 5", "2024-05-10 01:00", "2024-05-13 00:00"},
+		{"0 0 13 * 5", "2024-05-13 01:00", "2024-05-17 00:00"},
+	} {
+		spec, err := Parse(tc.expr)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tc.expr, err)
+			continue
+		}
+		if got := spec.Next(at(tc.from)); !got.Equal(at(tc.want)) {
+			t.Errorf("%q after %s = %s, want %s", tc.expr, tc.from, got.Format("2006-01-02 15:04"), tc.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+		"@every 30s",
+		"@every soon",
+		"@fortnightly",
+	} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q) succeeded", expr)
+		}
+	}
+}
\ No newline at end of file
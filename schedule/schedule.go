@@ -0,0 +1,291 @@
+package schedule
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/scanner"
+)
+
+type Options struct {
+	Mode           string   `json:"mode"`
+	Cron           []string `json:"cron"`
+	RunOnStart     bool     `json:"run_on_start"`
+	QuietHours     string   `json:"quiet_hours"`
+	DailyDataCapMB int      `json:"daily_data_cap_mb"`
+	ResultDir      string   `json:"result_dir"`
+	KeepRuns       int      `json:"keep_runs"`
+	StateFile      string   `json:"state_file"`
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Mode:       "normal",
+		Cron:       []string{"@every 6h"},
+		RunOnStart: true,
+		ResultDir:  "results",
+		KeepRuns:   20,
+		StateFile:  "schedule_state.json",
+	}
+}
+
+// window is a daily time range in minutes after midnight. It may wrap
+// past midnight, as in 23:00-07:00.
+type window struct {
+	from, to int
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func parseWindow(s string) (*window, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	parts := strings.Split(s, "-")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid quiet hours %q, expected HH:MM-HH:MM", s)
+	}
+	from, err := parseClock(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	to, err := parseClock(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	return &window{from, to}, nil
+}
+
+func (w *window) contains(t time.Time) bool {
+	if w == nil {
+		return false
+	}
+	m := t.Hour()*60 + t.Minute()
+	if w.from <= w.to {
+		return m >= w.from && m < w.to
+	}
+	return m >= w.from || m < w.to
+}
+
+// usage counts the bytes downloaded by scans per calendar day and keeps
+// the count in a state file so the cap survives restarts.
+type usage struct {
+	mu    sync.Mutex
+	path  string
+	Date  string `json:"date"`
+	Bytes int64  `json:"bytes"`
+}
+
+func loadUsage(path string) *usage {
+	u := &usage{path: path}
+	if data, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(data, u)
+	}
+	return u
+}
+
+func (u *usage) add(n int64, now time.Time) int64 {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	today := now.Format("2006-01-02")
+	if u.Date != today {
+		u.Date = today
+		u.Bytes = 0
+	}
+	u.Bytes += n
+	return u.Bytes
+}
+
+func (u *usage) save() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.path == "" {
+		return
+	}
+	if data, err := json.Marshal(u); err == nil {
+		os.WriteFile(u.path, data, 0644)
+	}
+}
+
+// Scheduler runs a job whenever one of its specs fires, skipping runs that
+// fall into quiet hours or happen after the daily data cap is used up.
+type Scheduler struct {
+	opts  Options
+	specs []Spec
+	quiet *window
+	usage *usage
+}
+
+func New(opts Options) (*Scheduler, error) {
+	s := &Scheduler{opts: opts, usage: loadUsage(opts.StateFile)}
+	for _, expr := range opts.Cron {
+		spec, err := Parse(expr)
+		if err != nil {
+			return nil, err
+		}
+		s.specs = append(s.specs, spec)
+	}
+	if len(s.specs) == 0 {
+		return nil, fmt.Errorf("no schedule configured")
+	}
+	quiet, err := parseWindow(opts.QuietHours)
+	if err != nil {
+		return nil, err
+	}
+	s.quiet = quiet
+	return s, nil
+}
+
+// Next returns the first fire time after t that is outside quiet hours.
+func (s *Scheduler) Next(t time.Time) time.Time {
+	for i := 0; i < 100000; i++ {
+		var next time.Time
+		for _, spec := range s.specs {
+			n := spec.Next(t)
+			if !n.IsZero() && (next.IsZero() || n.Before(next)) {
+				next = n
+			}
+		}
+		if next.IsZero() || !s.quiet.contains(next) {
+			return next
+		}
+		t = next
+	}
+	return time.Time{}
+}
+
+// nextRun returns the first fire time after last that is not before now,
+// so a run that took longer than the interval skips the fire times it
+// overran instead of catching up on them one after another.
+func (s *Scheduler) nextRun(last, now time.Time) time.Time {
+	next := s.Next(last)
+	for !next.IsZero() && next.Before(now) {
+		next = s.Next(next)
+	}
+	return next
+}
+
+func (s *Scheduler) capBytes() int64 {
+	return int64(s.opts.DailyDataCapMB) * 1024 * 1024
+}
+
+// UsedToday returns the bytes downloaded by scans today.
+func (s *Scheduler) UsedToday() int64 {
+	return s.usage.add(0, time.Now())
+}
+
+func (s *Scheduler) capReached() bool {
+	return s.capBytes() > 0 && s.UsedToday() >= s.capBytes()
+}
+
+// Run calls job at every fire time until stopCh is closed. The channel
+// passed to job is closed when the daily data cap is reached mid-run.
+func (s *Scheduler) Run(stopCh <-chan struct{}, job func(capCh <-chan struct{})) {
+	var last time.Time
+	if !s.opts.RunOnStart {
+		last = time.Now()
+	}
+	for {
+		if !last.IsZero() {
+			next := s.nextRun(last, time.Now())
+			if next.IsZero() {
+				color.New(color.FgYellow).Println("Schedule has no further runs.")
+				return
+			}
+			color.New(color.FgCyan).Printf("Next scan at %s\n", next.Format("2006-01-02 15:04"))
+			select {
+			case <-stopCh:
+				return
+			case <-time.After(time.Until(next)):
+			}
+			last = next
+		} else {
+			last = time.Now()
+			if s.quiet.contains(last) {
+				color.New(color.FgYellow).Println("Quiet hours, skipping the initial scan.")
+				continue
+			}
+		}
+
+		if s.capReached() {
+			color.New(color.FgYellow).Printf("Daily data cap of %d MB reached, skipping this run.\n", s.opts.DailyDataCapMB)
+			continue
+		}
+		s.runJob(stopCh, job)
+		select {
+		case <-stopCh:
+			return
+		default:
+		}
+	}
+}
+
+func (s *Scheduler) runJob(stopCh <-chan struct{}, job func(capCh <-chan struct{})) {
+	capCh := make(chan struct{})
+	var once sync.Once
+	unsubscribe := scanner.Subscribe(func(e scanner.Event) {
+		if e.Type != scanner.EventBytes {
+			return
+		}
+		used := s.usage.add(e.Bytes, time.Now())
+		if s.capBytes() > 0 && used >= s.capBytes() {
+			once.Do(func() { close(capCh) })
+		}
+	})
+	defer func() {
+		unsubscribe()
+		s.usage.save()
+	}()
+
+	job(capCh)
+}
+
+// ResultPath returns dir/<base>_<timestamp><ext> for a run started at t.
+func ResultPath(dir, name string, t time.Time) string {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	return filepath.Join(dir, fmt.Sprintf("%s_%s%s", base, t.Format("20060102-150405"), ext))
+}
+
+// Rotate deletes all but the newest keep result files created from name.
+func Rotate(dir, name string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	matches, err := filepath.Glob(filepath.Join(dir, base+"_*"+ext))
+	if err != nil {
+		return err
+	}
+	// Only files whose suffix is exactly a timestamp belong to name; this
+	// keeps clean_ips_list_* from being counted as clean_ips_*.
+	var files []string
+	for _, m := range matches {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(m), base+"_"), ext)
+		if _, err := time.Parse("20060102-150405", stamp); err == nil {
+			files = append(files, m)
+		}
+	}
+	sort.Strings(files)
+	for len(files) > keep {
+		if err := os.Remove(files[0]); err != nil {
+			return err
+		}
+		files = files[1:]
+	}
+	return nil
+}
\ No newline at end of file
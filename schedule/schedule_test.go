@@ -0,0 +1,85 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWindowContains(t *testing.T) {
+	for _, tc := range []struct {
+		window string
+		clock  string
+		want   bool
+	}{
+		{"09:00-17:00", "09:00", true},
+		{"09:00-17:00", "16:59", true},
+		{"09:00-17:00", "17:00", false},
+		{"09:00-17:00", "08:59", false},
+		// Quiet hours that wrap past midnight.
+		{"23:00-07:00", "23:00", true},
+		{"23:00-07:00", "23:30", true},
+		{"23:00-07:00", "00:00", true},
+		{"23:00-07:00", "06:59", true},
+		{"23:00-07:00", "07:00", false},
+		{"23:00-07:00", "12:00", false},
+		{"23:00-07:00", "22:59", false},
+		{"", "12:00", false},
+	} {
+		w, err := parseWindow(tc.window)
+		if err != nil {
+			t.Fatalf("parseWindow(%q): %v", tc.window, err)
+		}
+		if got := w.contains(at("2024-05-01 " + tc.clock)); got != tc.want {
+			t.Errorf("%q contains %s = %v, want %v", tc.window, tc.clock, got, tc.want)
+		}
+	}
+
+	for _, s := range []string{"9-17", "09:00", "25:00-01:00", "09:00-17:00-18:00"} {
+		if _, err := parseWindow(s); err == nil {
+			t.Errorf("parseWindow(%q) succeeded", s)
+		}
+	}
+}
+
+func newTestScheduler(t *testing.T, quiet string, cron ...string) *Scheduler {
+	s, err := New(Options{Cron: cron, QuietHours: quiet})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestSchedulerNext(t *testing.T) {
+	s := newTestScheduler(t, "23:00-07:00", "0 */2 * * *", "30 9 * * *")
+	for _, tc := range []struct{ from, want string }{
+		{"2024-05-01 12:10", "2024-05-01 14:00"},
+		// The earliest of the specs wins.
+		{"2024-05-01 09:10", "2024-05-01 09:30"},
+		// Fire times in quiet hours are skipped.
+		{"2024-05-01 22:10", "2024-05-02 08:00"},
+	} {
+		if got := s.Next(at(tc.from)); !got.Equal(at(tc.want)) {
+			t.Errorf("Next(%s) = %s, want %s", tc.from, got.Format("2006-01-02 15:04"), tc.want)
+		}
+	}
+}
+
+func TestSchedulerNextRunSkipsOverrun(t *testing.T) {
+	s := newTestScheduler(t, "", "*/5 * * * *")
+	for _, tc := range []struct{ last, now, want string }{
+		{"2024-05-01 12:00", "2024-05-01 12:02", "2024-05-01 12:05"},
+		// A 20 minute scan skips the slots it ran through.
+		{"2024-05-01 12:00", "2024-05-01 12:20", "2024-05-01 12:20"},
+		{"2024-05-01 12:00", "2024-05-01 12:21", "2024-05-01 12:25"},
+	} {
+		if got := s.nextRun(at(tc.last), at(tc.now)); !got.Equal(at(tc.want)) {
+			t.Errorf("nextRun(%s, %s) = %s, want %s", tc.last, tc.now, got.Format("2006-01-02 15:04"), tc.want)
+		}
+	}
+
+	s = newTestScheduler(t, "", "@every 6h")
+	got := s.nextRun(at("2024-05-01 00:00"), at("2024-05-01 13:00").Add(time.Second))
+	if want := at("2024-05-01 18:00"); !got.Equal(want) {
+		t.Errorf("@every 6h after an overrun = %s, want %s", got, want)
+	}
+}
\ No newline at end of file
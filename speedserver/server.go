@@ -0,0 +1,162 @@
+package speedserver
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Options configures the speed test server. Put it behind a domain proxied
+// by Cloudflare, on one of the ports Cloudflare forwards (80, 8080, 8880,
+// 2052, 2082, 2086 or 2095 for plain HTTP; 443, 8443, 2053, 2083, 2087 or
+// 2096 with CertFile and KeyFile), and point the scanner's speed test URL
+// at https://your-domain/__down.
+type Options struct {
+	Listen       string `json:"listen"`
+	CertFile     string `json:"cert_file"`
+	KeyFile      string `json:"key_file"`
+	DefaultBytes int64  `json:"default_bytes"`
+	MaxBytes     int64  `json:"max_bytes"`
+	Token        string `json:"token"`
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Listen:       ":8080",
+		DefaultBytes: 50 * 1024 * 1024,
+		MaxBytes:     200 * 1024 * 1024,
+	}
+}
+
+// payloadBlock is repeated to fill downloads. It is random so that nothing
+// on the way can compress it.
+const payloadBlock = 1024 * 1024
+
+// Server answers the same requests as speed.cloudflare.com: GET
+// /__down?bytes=N sends N bytes and POST /__up reads and discards the
+// body. GET /generate_204 answers with no content, for latency probes.
+type Server struct {
+	opts    Options
+	payload []byte
+	mux     *http.ServeMux
+}
+
+func New(opts Options) *Server {
+	s := &Server{
+		opts:    opts,
+		payload: make([]byte, payloadBlock),
+		mux:     http.NewServeMux(),
+	}
+	rand.Read(s.payload)
+	s.mux.HandleFunc("/__down", s.handleDown)
+	s.mux.HandleFunc("/__up", s.handleUp)
+	s.mux.HandleFunc("/generate_204", s.handle204)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	s.mux.ServeHTTP(w, r)
+}
+
+// authorized reports whether r carries the token, as a bearer token or in
+// the token query parameter.
+func (s *Server) authorized(r *http.Request) bool {
+	if s.opts.Token == "" {
+		return true
+	}
+	token := []byte(s.opts.Token)
+	auth := []byte(r.Header.Get("Authorization"))
+	query := []byte(r.URL.Query().Get("token"))
+	return subtle.ConstantTimeCompare(auth, append([]byte("Bearer "), token...)) == 1 ||
+		subtle.ConstantTimeCompare(query, token) == 1
+}
+
+// TLS reports whether the server serves HTTPS.
+func (s *Server) TLS() bool {
+	return s.opts.CertFile != "" && s.opts.KeyFile != ""
+}
+
+// ListenAndServe serves until the listener fails. There is no write
+// timeout, as a download of MaxBytes over a slow link can take minutes.
+func (s *Server) ListenAndServe() error {
+	srv := &http.Server{
+		Addr:              s.opts.Listen,
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       120 * time.Second,
+	}
+	if s.TLS() {
+		return srv.ListenAndServeTLS(s.opts.CertFile, s.opts.KeyFile)
+	}
+	return srv.ListenAndServe()
+}
+
+func (s *Server) handleDown(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	size := s.opts.DefaultBytes
+	if v := r.URL.Query().Get("bytes"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid bytes", http.StatusBadRequest)
+			return
+		}
+		size = n
+	}
+	if s.opts.MaxBytes > 0 && size > s.opts.MaxBytes {
+		size = s.opts.MaxBytes
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	if r.Method == http.MethodHead {
+		return
+	}
+	for size > 0 {
+		chunk := s.payload
+		if size < int64(len(chunk)) {
+			chunk = chunk[:size]
+		}
+		if _, err := w.Write(chunk); err != nil {
+			return
+		}
+		size -= int64(len(chunk))
+	}
+}
+
+type uploadJSON struct {
+	Bytes      int64 `json:"bytes"`
+	DurationMs int64 `json:"duration_ms"`
+}
+
+func (s *Server) handleUp(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	start := time.Now()
+	n, err := io.Copy(io.Discard, r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(uploadJSON{Bytes: n, DurationMs: time.Since(start).Milliseconds()})
+}
+
+func (s *Server) handle204(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNoContent)
+}
\ No newline at end of file
@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/scanner"
+)
+
+func fragmentSpeed(r scanner.FragmentResult) string {
+	if r.SpeedFailure != "" {
+		return "failed (" + string(r.SpeedFailure) + ")"
+	}
+	if r.Speed == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f MB/s", r.Speed/1024/1024)
+}
+
+func fragmentLatency(r scanner.FragmentResult) string {
+	if r.Latency == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%dms", r.Latency.Milliseconds())
+}
+
+func PrintFragmentResults(results []scanner.FragmentResult) {
+	cyan := color.New(color.FgCyan, color.Bold)
+	green := color.New(color.FgGreen, color.Bold)
+	rule := strings.Repeat("=", 78)
+
+	fmt.Println()
+	cyan.Println(rule)
+	cyan.Printf("%*s\n", (len(rule)+len("FRAGMENT SWEEP RESULTS"))/2, "FRAGMENT SWEEP RESULTS")
+	cyan.Println(rule)
+	fmt.Println()
+
+	green.Printf("%-4s %-10s %-10s %-10s %-9s %-9s %s\n", "#", "Packets", "Length", "Interval", "Success", "Latency", "Speed")
+	cyan.Println(strings.Repeat("-", 78))
+	for i, r := range results {
+		line := fmt.Sprintf("%-4d %-10s %-10s %-10s %-9s %-9s %s",
+			i+1,
+			r.Fragment.Packets,
+			r.Fragment.Length,
+			r.Fragment.Interval,
+			fmt.Sprintf("%.0f%%", r.SuccessRate()*100),
+			fragmentLatency(r),
+			fragmentSpeed(r),
+		)
+		switch {
+		case r.SuccessRate() >= 0.9:
+			color.New(color.FgGreen).Println(line)
+		case r.Succeeded > 0:
+			color.New(color.FgYellow).Println(line)
+		default:
+			color.New(color.FgRed).Println(line)
+		}
+	}
+	cyan.Println(rule)
+}
+
+// PrintFragmentOutbound shows the outbound for the winning combination and
+// how to hook it up.
+func PrintFragmentOutbound(block []byte, tag, dialer string) {
+	fmt.Println()
+	color.New(color.FgGreen, color.Bold).Println("Best fragment outbound (add it to \"outbounds\"):")
+	fmt.Println(string(block))
+	color.New(color.FgYellow).Printf("and point %s at it with \"sockopt\": {\"dialerProxy\": \"%s\"} in its streamSettings.\n", dialer, tag)
+}
+
+func SaveFragmentResults(results []scanner.FragmentResult, block []byte, filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	file.WriteString("# Fragment sweep results\n")
+	file.WriteString(fmt.Sprintf("# Generated at: %s\n", time.Now().Format("2006-01-02 15:04:05")))
+	file.WriteString("#\n")
+	file.WriteString("# Format: Rank | Packets | Length | Interval | Success | Latency | Speed | Best IP\n")
+	file.WriteString("#===========================================================================\n\n")
+
+	for i, r := range results {
+		bestIP := "-"
+		if r.BestIP != nil {
+			bestIP = r.BestIP.String()
+		}
+		file.WriteString(fmt.Sprintf("%d | %s | %s | %s | %d/%d | %s | %s | %s\n",
+			i+1,
+			r.Fragment.Packets,
+			r.Fragment.Length,
+			r.Fragment.Interval,
+			r.Succeeded,
+			r.Attempts,
+			fragmentLatency(r),
+			fragmentSpeed(r),
+			bestIP,
+		))
+	}
+
+	if block != nil {
+		file.WriteString("\n# Best fragment outbound:\n")
+		file.Write(block)
+		file.WriteString("\n")
+	}
+	file.WriteString("\n# End of results\n")
+	return nil
+}
\ No newline at end of file
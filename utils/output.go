@@ -3,54 +3,144 @@ package utils
 import (
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
-	"github.com/fatih/color"
 	"github.com/4n0nymou3/CF-Clean-IP-Scanner/scanner"
+	"github.com/fatih/color"
 )
 
+type OutputOptions struct {
+	ShowLatencyStats bool `json:"show_latency_stats"`
+}
+
+var outputOpts OutputOptions
+
+func Configure(o OutputOptions) {
+	outputOpts = o
+}
+
+// hasTunnel reports whether results come from a combined scan and so have
+// columns for the results through Xray.
+func hasTunnel(results []scanner.IPResult) bool {
+	for _, r := range results {
+		if r.Tunnel != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func tunnelColumns(t *scanner.TunnelResult) []string {
+	switch {
+	case t == nil:
+		return []string{"not checked", "-"}
+	case !t.OK():
+		return []string{"failed", "-"}
+	case !t.SpeedTested:
+		return []string{fmt.Sprintf("%dms", t.Delay), "not checked"}
+	}
+	return []string{
+		fmt.Sprintf("%dms", t.Delay),
+		fmt.Sprintf("%.2f MB/s", t.DownloadSpeed/1024/1024),
+	}
+}
+
+func resultColumns(r scanner.IPResult, tunnel bool) []string {
+	cols := []string{
+		r.IP.String(),
+		fmt.Sprintf("%d", r.Sended),
+		fmt.Sprintf("%d", r.Received),
+		fmt.Sprintf("%.2f", r.LossRate),
+		fmt.Sprintf("%dms", r.Delay),
+	}
+	if outputOpts.ShowLatencyStats {
+		cols = append(cols,
+			fmt.Sprintf("%dms", r.Jitter),
+			fmt.Sprintf("%dms", r.MinDelay),
+			fmt.Sprintf("%dms", r.MedianDelay),
+			fmt.Sprintf("%dms", r.P95Delay),
+			fmt.Sprintf("%dms", r.MaxDelay),
+		)
+	}
+	cols = append(cols, fmt.Sprintf("%.2f MB/s", r.DownloadSpeed/1024/1024))
+	if tunnel {
+		cols = append(cols, tunnelColumns(r.Tunnel)...)
+	}
+	return append(cols, fmt.Sprintf("%.1f", r.Score))
+}
+
+func formatColumns(cols []string, tunnel bool) string {
+	widths := []int{20, 6, 10, 10, 14}
+	if outputOpts.ShowLatencyStats {
+		widths = append(widths, 8, 8, 8, 8, 8)
+	}
+	widths = append(widths, 18)
+	if tunnel {
+		widths = append(widths, 14, 18)
+	}
+	widths = append(widths, 7)
+
+	line := ""
+	for i, c := range cols {
+		if i > 0 {
+			line += " "
+		}
+		line += fmt.Sprintf("%-*s", widths[i], c)
+	}
+	return line
+}
+
 func PrintResults(results []scanner.IPResult) {
+	header := []string{"IP Address", "Sent", "Received", "Loss", "Avg Delay"}
+	if outputOpts.ShowLatencyStats {
+		header = append(header, "Jitter", "Min", "Median", "P95", "Max")
+	}
+	header = append(header, "Download Speed")
+	tunnel := hasTunnel(results)
+	if tunnel {
+		header = append(header, "Xray Delay", "Xray Speed")
+	}
+	header = append(header, "Score")
+	headerLine := fmt.Sprintf("%-6s %s", "Rank", formatColumns(header, tunnel))
+	rule := strings.Repeat("=", len(headerLine))
+
 	fmt.Println()
 	cyan := color.New(color.FgCyan, color.Bold)
-	cyan.Println("===========================================================================")
-	cyan.Println("                      CLEAN IPs FOUND")
-	cyan.Println("===========================================================================")
+	cyan.Println(rule)
+	cyan.Printf("%*s\n", (len(rule)+len("CLEAN IPs FOUND"))/2, "CLEAN IPs FOUND")
+	cyan.Println(rule)
 	fmt.Println()
 
 	green := color.New(color.FgGreen, color.Bold)
 	white := color.New(color.FgWhite)
 	yellow := color.New(color.FgYellow, color.Bold)
 
-	green.Printf("%-6s %-20s %-6s %-10s %-10s %-14s %-18s\n",
-		"Rank", "IP Address", "Sent", "Received", "Loss", "Avg Delay", "Download Speed")
-	cyan.Println("---------------------------------------------------------------------------")
+	green.Println(headerLine)
+	cyan.Println(strings.Repeat("-", len(headerLine)))
 
 	for i, r := range results {
 		rank := fmt.Sprintf("%d.", i+1)
-		sent := fmt.Sprintf("%d", r.Sended)
-		recv := fmt.Sprintf("%d", r.Received)
-		loss := fmt.Sprintf("%.2f", r.LossRate)
-		delay := fmt.Sprintf("%dms", r.Delay)
-		speed := fmt.Sprintf("%.2f MB/s", r.DownloadSpeed/1024/1024)
+		row := formatColumns(resultColumns(r, tunnel), tunnel)
 
 		if i == 0 {
-			yellow.Printf("%-6s %-20s %-6s %-10s %-10s %-14s %-18s\n",
-				rank, r.IP.String(), sent, recv, loss, delay, speed)
-		} else if r.LossRate == 0 && r.Delay < 150 {
+			yellow.Printf("%-6s %s\n", rank, row)
+			continue
+		}
+
+		switch scanner.GradeOf(r) {
+		case scanner.GradeGood:
 			white.Printf("%-6s ", rank)
-			color.New(color.FgGreen).Printf("%-20s %-6s %-10s %-10s %-14s %-18s\n",
-				r.IP.String(), sent, recv, loss, delay, speed)
-		} else if r.LossRate == 0 {
+			color.New(color.FgGreen).Println(row)
+		case scanner.GradeFair:
 			white.Printf("%-6s ", rank)
-			color.New(color.FgCyan).Printf("%-20s %-6s %-10s %-10s %-14s %-18s\n",
-				r.IP.String(), sent, recv, loss, delay, speed)
-		} else {
-			white.Printf("%-6s %-20s %-6s %-10s %-10s %-14s %-18s\n",
-				rank, r.IP.String(), sent, recv, loss, delay, speed)
+			color.New(color.FgCyan).Println(row)
+		default:
+			white.Printf("%-6s %s\n", rank, row)
 		}
 	}
 
-	cyan.Println("===========================================================================")
+	cyan.Println(rule)
 }
 
 func SaveResults(results []scanner.IPResult, filename string) error {
@@ -64,20 +154,43 @@ func SaveResults(results []scanner.IPResult, filename string) error {
 	file.WriteString(fmt.Sprintf("# Generated at: %s\n", time.Now().Format("2006-01-02 15:04:05")))
 	file.WriteString(fmt.Sprintf("# Total IPs found: %d\n", len(results)))
 	file.WriteString("#\n")
-	file.WriteString("# Format: Rank | IP | Sent | Received | Loss | Avg Delay | Download Speed\n")
+	file.WriteString("# Format: Rank | IP | Sent | Received | Loss | Avg Delay | Jitter | Min/Median/P95/Max Delay | Download Speed | Peak Speed | TTFB | Score [| Failures] [| Xray Delay Speed]\n")
 	file.WriteString("#===========================================================================\n\n")
 
+	tunnel := hasTunnel(results)
 	for i, r := range results {
-		line := fmt.Sprintf("%d. %s | Sent: %d | Recv: %d | Loss: %.2f | %dms | %.2f MB/s\n",
+		line := fmt.Sprintf("%d. %s | Sent: %d | Recv: %d | Loss: %.2f | %dms | Jitter: %dms | %d/%d/%d/%dms | %.2f MB/s | Peak: %.2f MB/s | TTFB: %dms | Score: %.1f",
 			i+1,
 			r.IP.String(),
 			r.Sended,
 			r.Received,
 			r.LossRate,
 			r.Delay,
+			r.Jitter,
+			r.MinDelay,
+			r.MedianDelay,
+			r.P95Delay,
+			r.MaxDelay,
 			r.DownloadSpeed/1024/1024,
+			r.PeakSpeed/1024/1024,
+			r.TTFB,
+			r.Score,
 		)
-		file.WriteString(line)
+		if len(r.Failures) > 0 {
+			line += " | Failures: " + r.Failures.String()
+		}
+		switch t := r.Tunnel; {
+		case !tunnel:
+		case t == nil:
+			line += " | Xray: not checked"
+		case !t.OK():
+			line += " | Xray: failed"
+		case !t.SpeedTested:
+			line += fmt.Sprintf(" | Xray: %dms, speed not checked", t.Delay)
+		default:
+			line += fmt.Sprintf(" | Xray: %dms %.2f MB/s", t.Delay, t.DownloadSpeed/1024/1024)
+		}
+		file.WriteString(line + "\n")
 	}
 
 	file.WriteString("\n# End of results\n")
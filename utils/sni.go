@@ -0,0 +1,102 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/scanner"
+)
+
+func sniLabel(sni string) string {
+	if sni == "" {
+		return "(no SNI)"
+	}
+	return sni
+}
+
+func PrintSNIResults(results []scanner.SNIResult) {
+	cyan := color.New(color.FgCyan, color.Bold)
+	green := color.New(color.FgGreen, color.Bold)
+	rule := strings.Repeat("=", 70)
+
+	fmt.Println()
+	cyan.Println(rule)
+	cyan.Printf("%*s\n", (len(rule)+len("SNI SWEEP RESULTS"))/2, "SNI SWEEP RESULTS")
+	cyan.Println(rule)
+	fmt.Println()
+
+	green.Printf("%-40s %s\n", "SNI", "Working IPs")
+	cyan.Println(strings.Repeat("-", 70))
+	for _, s := range scanner.SummarizeSNI(results) {
+		line := fmt.Sprintf("%-40s %d/%d", sniLabel(s.SNI), s.Working, s.Tested)
+		switch {
+		case s.Working == s.Tested:
+			color.New(color.FgGreen).Println(line)
+		case s.Working > 0:
+			color.New(color.FgYellow).Println(line)
+		default:
+			color.New(color.FgRed).Println(line)
+		}
+	}
+	fmt.Println()
+
+	green.Printf("%-20s %s\n", "IP Address", "Working SNIs (handshake)")
+	cyan.Println(strings.Repeat("-", 70))
+	var order []string
+	byIP := make(map[string][]string)
+	for _, r := range results {
+		ip := r.IP.String()
+		if _, ok := byIP[ip]; !ok {
+			order = append(order, ip)
+			byIP[ip] = nil
+		}
+		if r.OK() {
+			byIP[ip] = append(byIP[ip], fmt.Sprintf("%s (%dms)", sniLabel(r.SNI), r.Handshake.Milliseconds()))
+		}
+	}
+	for _, ip := range order {
+		if len(byIP[ip]) == 0 {
+			color.New(color.FgRed).Printf("%-20s none\n", ip)
+			continue
+		}
+		color.New(color.FgWhite).Printf("%-20s %s\n", ip, strings.Join(byIP[ip], ", "))
+	}
+	cyan.Println(rule)
+}
+
+func SaveSNIResults(results []scanner.SNIResult, filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	file.WriteString("# SNI sweep results\n")
+	file.WriteString(fmt.Sprintf("# Generated at: %s\n", time.Now().Format("2006-01-02 15:04:05")))
+	file.WriteString("#\n")
+	file.WriteString("# Format: IP | SNI | TLS | Cloudflare | HTTP Status | Handshake | Colo | Error\n")
+	file.WriteString("#===========================================================================\n\n")
+
+	for _, r := range results {
+		errText := ""
+		if r.Err != nil {
+			errText = string(scanner.ClassifyError(r.Err))
+		}
+		file.WriteString(fmt.Sprintf("%s | %s | TLS: %t | CF: %t | %d | %dms | %s | %s\n",
+			r.IP.String(),
+			sniLabel(r.SNI),
+			r.TLS,
+			r.Cloudflare,
+			r.Status,
+			r.Handshake.Milliseconds(),
+			r.Colo,
+			errText,
+		))
+	}
+
+	file.WriteString("\n# End of results\n")
+	return nil
+}
\ No newline at end of file
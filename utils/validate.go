@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/4n0nymou3/CF-Clean-IP-Scanner/scanner"
+)
+
+// PrintValidation shows one line per check of scanner.ValidateXrayConfig,
+// with the details and a hint for the ones that failed.
+func PrintValidation(checks []scanner.ValidationCheck) {
+	for _, c := range checks {
+		switch {
+		case c.OK():
+			color.New(color.FgGreen).Printf("  [ OK ] %s", c.Name)
+			if c.Detail != "" && !strings.HasPrefix(c.Detail, "line ") {
+				color.New(color.FgWhite).Printf(" (%s)", c.Detail)
+			}
+			fmt.Println()
+			continue
+		case c.Warning:
+			color.New(color.FgYellow).Printf("  [WARN] %s: %v\n", c.Name, c.Err)
+		default:
+			color.New(color.FgRed).Printf("  [FAIL] %s: %v\n", c.Name, c.Err)
+		}
+		for _, line := range strings.Split(c.Detail, "\n") {
+			if line != "" {
+				color.New(color.FgWhite).Printf("         %s\n", line)
+			}
+		}
+		if c.Hint != "" {
+			color.New(color.FgCyan).Printf("         %s\n", c.Hint)
+		}
+	}
+}
\ No newline at end of file